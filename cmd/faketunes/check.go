@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"source.hodakov.me/hdkv/faketunes/internal/application"
+	"source.hodakov.me/hdkv/faketunes/internal/domains"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/checker"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/transcoder"
+)
+
+// runCheck runs the full source library integrity check instead of mounting
+// the filesystem. It exits with non-zero code if corrupt files were found.
+func runCheck(app *application.App, cancel context.CancelFunc) {
+	app.Logger().Info("Running faketunes in check mode...")
+
+	app.RegisterDomain(domains.TranscoderName, transcoder.New(app))
+	app.RegisterDomain(domains.CheckerName, checker.New(app))
+
+	err := app.ConnectDependencies()
+	if err != nil {
+		app.Logger().Fatal(err)
+	}
+
+	// CTRL+C handler.
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(
+		interrupt, syscall.SIGINT, syscall.SIGTERM,
+	)
+
+	go func() {
+		signalThing := <-interrupt
+		app.Logger().WithField("signal", signalThing.String()).
+			Info("Got terminating signal, stopping the check...")
+
+		cancel()
+	}()
+
+	checkerDomain, ok := app.RetrieveDomain(domains.CheckerName).(domains.Checker)
+	if !ok {
+		app.Logger().Fatal("checker domain interface conversion failed")
+	}
+
+	summary, err := checkerDomain.CheckLibrary(true)
+	if err != nil {
+		app.Logger().Fatal(err)
+	}
+
+	if summary.Corrupt > 0 || summary.Failed > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
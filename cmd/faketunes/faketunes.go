@@ -10,8 +10,11 @@ import (
 	"source.hodakov.me/hdkv/faketunes/internal/application"
 	"source.hodakov.me/hdkv/faketunes/internal/domains"
 	"source.hodakov.me/hdkv/faketunes/internal/domains/cacher"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/checker"
 	"source.hodakov.me/hdkv/faketunes/internal/domains/filesystem"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library"
 	"source.hodakov.me/hdkv/faketunes/internal/domains/transcoder"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/watcher"
 )
 
 func main() {
@@ -28,9 +31,16 @@ func main() {
 
 	app.InitLogger()
 
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		runCheck(app, cancel)
+	}
+
 	app.RegisterDomain(domains.FilesystemName, filesystem.New(app))
 	app.RegisterDomain(domains.CacherName, cacher.New(app))
 	app.RegisterDomain(domains.TranscoderName, transcoder.New(app))
+	app.RegisterDomain(domains.CheckerName, checker.New(app))
+	app.RegisterDomain(domains.LibraryName, library.New(app))
+	app.RegisterDomain(domains.WatcherName, watcher.New(app))
 
 	err = app.ConnectDependencies()
 	if err != nil {
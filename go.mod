@@ -6,6 +6,6 @@ require (
 	github.com/goccy/go-yaml v1.19.2
 	github.com/hanwen/go-fuse/v2 v2.9.0
 	github.com/sirupsen/logrus v1.9.4
+	golang.org/x/sys v0.28.0
+	golang.org/x/text v0.21.0
 )
-
-require golang.org/x/sys v0.28.0 // indirect
@@ -3,6 +3,7 @@ package configuration
 import (
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/goccy/go-yaml"
 	"github.com/sirupsen/logrus"
@@ -11,21 +12,50 @@ import (
 type Config struct {
 	Paths       Paths       `yaml:"paths"`
 	FakeTunes   FakeTunes   `yaml:"faketunes"`
+	Mount       Mount       `yaml:"mount"`
 	Transcoding Transcoding `yaml:"transcoding"`
+	Passthrough Passthrough `yaml:"passthrough"`
+	Names       Names       `yaml:"names"`
+	Layout      Layout      `yaml:"layout"`
+	Views       Views       `yaml:"views"`
+	Search      Search      `yaml:"search"`
+	Playlists   Playlists   `yaml:"playlists"`
+	Metadata    Metadata    `yaml:"metadata"`
+	Checker     Checker     `yaml:"checker"`
+	Watcher     Watcher     `yaml:"watcher"`
 }
 
 type FakeTunes struct {
 	CacheSize int64        `yaml:"cache_size"`
+	StatCache StatCache    `yaml:"stat_cache"`
 	LogLevel  logrus.Level `yaml:"log_level"`
 }
 
+type StatCache struct {
+	MaxEntries int           `yaml:"max_entries"`
+	TTL        time.Duration `yaml:"ttl"`
+}
+
 type Paths struct {
 	Source      string `yaml:"source"`
 	Destination string `yaml:"destination"`
 }
 
 type Transcoding struct {
-	Parallel int64 `yaml:"parallel"`
+	Parallel int64              `yaml:"parallel"`
+	Verify   bool               `yaml:"verify"`
+	Profile  string             `yaml:"profile"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+type Checker struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"`
+}
+
+type Watcher struct {
+	Enabled  bool          `yaml:"enabled"`
+	Debounce time.Duration `yaml:"debounce"`
 }
 
 func New() (*Config, error) {
@@ -46,5 +76,59 @@ func New() (*Config, error) {
 		return nil, fmt.Errorf("%w: %w (%w)", ErrConfiguration, ErrCantParseConfigFile, err)
 	}
 
+	config.Mount.applyDefaults()
+	config.Transcoding.applyDefaults()
+	config.Passthrough.applyDefaults()
+	config.Names.applyDefaults()
+	config.Layout.applyDefaults()
+	config.Views.applyDefaults()
+	config.Search.applyDefaults()
+	config.Metadata.applyDefaults()
+
+	err = config.Mount.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Transcoding.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Passthrough.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Names.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Layout.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Views.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Search.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Playlists.validate()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Metadata.validate()
+	if err != nil {
+		return nil, err
+	}
+
 	return config, nil
 }
@@ -7,4 +7,15 @@ var (
 	ErrCantReadConfigFile          = errors.New("can't read config file")
 	ErrCantParseConfigFile         = errors.New("can't parse config file")
 	ErrSourceDirectoryDoesNotExist = errors.New("source directory does not exist")
+	ErrUnknownProfile              = errors.New("unknown transcoding profile")
+	ErrInvalidProfile              = errors.New("invalid transcoding profile")
+	ErrInvalidExtension            = errors.New("invalid passthrough file extension")
+	ErrInvalidMetadataRule         = errors.New("invalid client metadata rule")
+	ErrInvalidMountOption          = errors.New("invalid mount option")
+	ErrInvalidNormalization        = errors.New("invalid unicode normalization form")
+	ErrInvalidNameOption           = errors.New("invalid file name option")
+	ErrInvalidLayout               = errors.New("invalid layout template")
+	ErrInvalidViews                = errors.New("invalid views option")
+	ErrInvalidSearch               = errors.New("invalid search option")
+	ErrInvalidPlaylist             = errors.New("invalid smart playlist")
 )
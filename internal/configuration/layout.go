@@ -0,0 +1,49 @@
+package configuration
+
+import (
+	"fmt"
+
+	"source.hodakov.me/hdkv/faketunes/internal/pathtemplate"
+)
+
+const (
+	DefaultSinglesAlbum  = "Singles"
+	DefaultUnknownArtist = "Unknown Artist"
+)
+
+// Layout builds the virtual tree from the track tags instead of mirroring
+// the source directories. Tracks without the album tag are grouped into the
+// singles album of their artist.
+type Layout struct {
+	Template      string `yaml:"template"`
+	Singles       string `yaml:"singles"`
+	UnknownArtist string `yaml:"unknown_artist"`
+}
+
+// Enabled returns true if the virtual tree is built from the template.
+func (l *Layout) Enabled() bool {
+	return l.Template != ""
+}
+
+func (l *Layout) applyDefaults() {
+	if l.Singles == "" {
+		l.Singles = DefaultSinglesAlbum
+	}
+
+	if l.UnknownArtist == "" {
+		l.UnknownArtist = DefaultUnknownArtist
+	}
+}
+
+func (l *Layout) validate() error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	_, err := pathtemplate.Parse(l.Template)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrConfiguration, ErrInvalidLayout, err)
+	}
+
+	return nil
+}
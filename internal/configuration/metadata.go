@@ -0,0 +1,90 @@
+package configuration
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+const (
+	MetadataPresetITunes   = "itunes"
+	MetadataPresetFinder   = "finder"
+	MetadataPresetExplorer = "explorer"
+	MetadataPresetSamba    = "samba"
+)
+
+// MetadataPresets are the glob rules for the files and directories the
+// clients create next to the music library. Globs are matched against the
+// lowercased name.
+var MetadataPresets = map[string][]string{
+	MetadataPresetITunes: {
+		"itunes library*", "itunes music library*.xml", "*.itl", "*.itdb", "*.itc", "*.itc2",
+		"album artwork", "previous itunes libraries", "itunes media", "temp file*.tmp",
+	},
+	MetadataPresetFinder: {
+		".ds_store", "._*", ".spotlight-v100", ".trashes", ".fseventsd", ".temporaryitems",
+		".apdisk", ".volumeicon.icns", ".com.apple.timemachine.*", "icon\r",
+	},
+	MetadataPresetExplorer: {
+		"desktop.ini", "thumbs.db", "ehthumbs.db", "ehthumbs_vista.db", "folder.jpg",
+		"albumart*.jpg", "$recycle.bin", "system volume information",
+	},
+	MetadataPresetSamba: {
+		".smbdelete*", ".recycle", ".deleted", ".streams",
+	},
+}
+
+// Metadata decides which names belong to client metadata: writable files kept
+// outside the source library. Globs are matched case-insensitively, regexes
+// against the name as is. Names of the real library content are never treated
+// as metadata, whatever the rules say.
+type Metadata struct {
+	Presets []string `yaml:"presets"`
+	Globs   []string `yaml:"globs"`
+	Regexes []string `yaml:"regexes"`
+}
+
+// Rules returns the globs of the enabled presets along with the custom ones.
+func (m *Metadata) Rules() []string {
+	globs := make([]string, 0)
+	for _, preset := range m.Presets {
+		globs = append(globs, MetadataPresets[preset]...)
+	}
+
+	return append(globs, m.Globs...)
+}
+
+func (m *Metadata) applyDefaults() {
+	for i, glob := range m.Globs {
+		m.Globs[i] = strings.ToLower(glob)
+	}
+
+	if m.Presets == nil {
+		m.Presets = []string{
+			MetadataPresetITunes, MetadataPresetFinder, MetadataPresetExplorer, MetadataPresetSamba,
+		}
+	}
+}
+
+func (m *Metadata) validate() error {
+	for _, preset := range m.Presets {
+		if _, ok := MetadataPresets[preset]; !ok {
+			return fmt.Errorf("%w: %w (unknown preset %q)", ErrConfiguration, ErrInvalidMetadataRule, preset)
+		}
+	}
+
+	for _, glob := range m.Globs {
+		if _, err := path.Match(glob, ""); err != nil || strings.Contains(glob, "/") {
+			return fmt.Errorf("%w: %w (glob %q)", ErrConfiguration, ErrInvalidMetadataRule, glob)
+		}
+	}
+
+	for _, expression := range m.Regexes {
+		if _, err := regexp.Compile(expression); err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrConfiguration, ErrInvalidMetadataRule, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package configuration
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultFSName = "faketunes"
+
+	// maxReadahead is the kernel limit for the FUSE readahead.
+	maxReadahead  = 128 * 1024
+	fuseConfPath  = "/etc/fuse.conf"
+	userAllowLine = "user_allow_other"
+)
+
+// Umask is the octal permission mask, like "022".
+type Umask uint32
+
+func (u *Umask) UnmarshalYAML(data []byte) error {
+	value := strings.Trim(strings.TrimSpace(string(data)), `"'`)
+	value = strings.TrimPrefix(value, "0o")
+
+	mask, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return fmt.Errorf("%w: %w (umask %q)", ErrConfiguration, ErrInvalidMountOption, value)
+	}
+
+	*u = Umask(mask)
+
+	return nil
+}
+
+type Mount struct {
+	AllowOther   bool           `yaml:"allow_other"`
+	UID          *uint32        `yaml:"uid"`
+	GID          *uint32        `yaml:"gid"`
+	FileUmask    Umask          `yaml:"file_umask"`
+	DirUmask     Umask          `yaml:"dir_umask"`
+	FSName       string         `yaml:"fsname"`
+	EntryTimeout *time.Duration `yaml:"entry_timeout"`
+	AttrTimeout  *time.Duration `yaml:"attr_timeout"`
+	MaxReadahead int            `yaml:"max_readahead"`
+}
+
+func (m *Mount) applyDefaults() {
+	if m.FSName == "" {
+		m.FSName = DefaultFSName
+	}
+}
+
+// validate checks the options the same way fusermount3 does, so the mount
+// doesn't fail after the application has started.
+func (m *Mount) validate() error {
+	if m.AllowOther && os.Getuid() != 0 && !userAllowOther() {
+		return invalidMountOption("allow_other requires %q in %s when not running as root", userAllowLine, fuseConfPath)
+	}
+
+	if strings.ContainsAny(m.FSName, ",\n\x00") {
+		return invalidMountOption("fsname %q can't contain commas, newlines or null bytes", m.FSName)
+	}
+
+	if m.FileUmask > 0o777 || m.DirUmask > 0o777 {
+		return invalidMountOption("umask must be between 000 and 777")
+	}
+
+	if m.EntryTimeout != nil && *m.EntryTimeout < 0 || m.AttrTimeout != nil && *m.AttrTimeout < 0 {
+		return invalidMountOption("cache timeouts can't be negative")
+	}
+
+	if m.MaxReadahead < 0 || m.MaxReadahead > maxReadahead {
+		return invalidMountOption("max_readahead must be between 0 and %d", maxReadahead)
+	}
+
+	return nil
+}
+
+// userAllowOther reports whether fusermount3 lets the regular users use the
+// allow_other option.
+func userAllowOther() bool {
+	file, err := os.Open(fuseConfPath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == userAllowLine {
+			return true
+		}
+	}
+
+	return false
+}
+
+func invalidMountOption(format string, args ...any) error {
+	return fmt.Errorf("%w: %w (%s)", ErrConfiguration, ErrInvalidMountOption, fmt.Sprintf(format, args...))
+}
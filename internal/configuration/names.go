@@ -0,0 +1,88 @@
+package configuration
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	NormalizationNone = "none"
+	NormalizationNFC  = "nfc"
+	NormalizationNFD  = "nfd"
+
+	DefaultNameReplacement = "_"
+	DefaultMaxNameLength   = 255
+
+	// MinNameLength leaves the room for the hash suffix and the extension of
+	// the shortened names.
+	MinNameLength = 24
+
+	// WindowsIllegalCharacters can't be used in the Windows file names.
+	WindowsIllegalCharacters = `<>:"/\|?*`
+)
+
+// Names decides how the clients' file names are matched with the library.
+// With normalization, the names are listed in the configured Unicode form
+// and looked up in any form, so "Björk" typed on macOS (NFD) finds the
+// directory created on Linux (NFC). With sanitizing, the characters Windows
+// can't handle are replaced, and the names making the paths longer than the
+// limits are shortened with a stable hash suffix. Lengths are in UTF-16 code
+// units, like Windows counts them, the path length is counted from the mount
+// root.
+type Names struct {
+	CaseInsensitive bool   `yaml:"case_insensitive"`
+	Normalization   string `yaml:"normalization"`
+	Sanitize        bool   `yaml:"sanitize"`
+	Replacement     string `yaml:"replacement"`
+	MaxNameLength   int    `yaml:"max_name_length"`
+	MaxPathLength   int    `yaml:"max_path_length"`
+}
+
+func (n *Names) applyDefaults() {
+	if n.Normalization == "" {
+		n.Normalization = NormalizationNone
+	}
+
+	if n.Replacement == "" {
+		n.Replacement = DefaultNameReplacement
+	}
+
+	if n.MaxNameLength == 0 {
+		n.MaxNameLength = DefaultMaxNameLength
+	}
+}
+
+func (n *Names) validate() error {
+	if !slices.Contains([]string{NormalizationNone, NormalizationNFC, NormalizationNFD}, n.Normalization) {
+		return fmt.Errorf(
+			"%w: %w (%q, must be %s, %s or %s)", ErrConfiguration, ErrInvalidNormalization,
+			n.Normalization, NormalizationNone, NormalizationNFC, NormalizationNFD,
+		)
+	}
+
+	if utf8.RuneCountInString(n.Replacement) != 1 ||
+		strings.ContainsAny(n.Replacement, WindowsIllegalCharacters+". ") || n.Replacement[0] < ' ' {
+		return fmt.Errorf(
+			"%w: %w (replacement %q must be a single character allowed on Windows)",
+			ErrConfiguration, ErrInvalidNameOption, n.Replacement,
+		)
+	}
+
+	if n.MaxNameLength < MinNameLength || n.MaxNameLength > DefaultMaxNameLength {
+		return fmt.Errorf(
+			"%w: %w (max_name_length must be between %d and %d)",
+			ErrConfiguration, ErrInvalidNameOption, MinNameLength, DefaultMaxNameLength,
+		)
+	}
+
+	if n.MaxPathLength != 0 && n.MaxPathLength < MinNameLength {
+		return fmt.Errorf(
+			"%w: %w (max_path_length must be 0 or at least %d)",
+			ErrConfiguration, ErrInvalidNameOption, MinNameLength,
+		)
+	}
+
+	return nil
+}
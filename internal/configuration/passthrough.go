@@ -0,0 +1,58 @@
+package configuration
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Passthrough decides which source files besides FLACs are served as is.
+// Extensions are matched case-insensitively, hidden ones take precedence, and
+// an empty exposed list means every extension that isn't hidden.
+type Passthrough struct {
+	Expose []string `yaml:"expose"`
+	Hide   []string `yaml:"hide"`
+}
+
+// Exposed returns true if the source file with the name should be served.
+func (p *Passthrough) Exposed(name string) bool {
+	extension := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+
+	if slices.Contains(p.Hide, extension) {
+		return false
+	}
+
+	return len(p.Expose) == 0 || slices.Contains(p.Expose, extension)
+}
+
+func (p *Passthrough) applyDefaults() {
+	p.Expose = normalizeExtensions(p.Expose)
+	p.Hide = normalizeExtensions(p.Hide)
+}
+
+func (p *Passthrough) validate() error {
+	for _, extension := range slices.Concat(p.Expose, p.Hide) {
+		if extension == "" || strings.ContainsAny(extension, "/.") {
+			return fmt.Errorf("%w: %w (%q)", ErrConfiguration, ErrInvalidExtension, extension)
+		}
+
+		if extension == "flac" {
+			return fmt.Errorf(
+				"%w: %w (%s)", ErrConfiguration, ErrInvalidExtension,
+				"flac files are always transcoded",
+			)
+		}
+	}
+
+	return nil
+}
+
+func normalizeExtensions(extensions []string) []string {
+	normalized := make([]string, 0, len(extensions))
+	for _, extension := range extensions {
+		normalized = append(normalized, strings.TrimPrefix(strings.ToLower(strings.TrimSpace(extension)), "."))
+	}
+
+	return normalized
+}
@@ -0,0 +1,42 @@
+package configuration
+
+import (
+	"fmt"
+	"strings"
+
+	"source.hodakov.me/hdkv/faketunes/internal/query"
+)
+
+// Playlists are the smart playlists shown as the .m3u8 files in the
+// Playlists directory of the mount. Every playlist has the tracks matching
+// its search query, like "rating:4.. genre:jazz" or "added:-30d..".
+type Playlists []Playlist
+
+type Playlist struct {
+	Name  string `yaml:"name"`
+	Query string `yaml:"query"`
+}
+
+func (p Playlists) validate() error {
+	names := make(map[string]struct{}, len(p))
+
+	for _, playlist := range p {
+		name := strings.TrimSpace(playlist.Name)
+		if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+			return fmt.Errorf("%w: %w (bad name %q)", ErrConfiguration, ErrInvalidPlaylist, playlist.Name)
+		}
+
+		if _, ok := names[strings.ToLower(name)]; ok {
+			return fmt.Errorf("%w: %w (duplicate name %q)", ErrConfiguration, ErrInvalidPlaylist, playlist.Name)
+		}
+
+		names[strings.ToLower(name)] = struct{}{}
+
+		_, err := query.Parse(playlist.Query, nil)
+		if err != nil {
+			return fmt.Errorf("%w: %w (playlist %q: %w)", ErrConfiguration, ErrInvalidPlaylist, playlist.Name, err)
+		}
+	}
+
+	return nil
+}
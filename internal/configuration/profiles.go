@@ -0,0 +1,283 @@
+package configuration
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultProfileName = "alac"
+
+	CodecALAC = "alac"
+	CodecAAC  = "aac"
+
+	RateFamilySource = "source"
+	RateFamily44100  = "44100"
+	RateFamily48000  = "48000"
+
+	ResamplerSoXR = "soxr"
+	ResamplerSWR  = "swr"
+
+	DitherNone = "none"
+
+	MonoKeep   = "keep"
+	MonoStereo = "stereo"
+
+	defaultCenterLevel   = 0.707
+	defaultSurroundLevel = 0.707
+	maxMixLevel          = 4
+	maxDialogueBoost     = 20
+)
+
+var (
+	dithers       = []string{DitherNone, "rectangular", "triangular", "triangular_hp"}
+	noiseShapings = []string{
+		DitherNone, "lipshitz", "shibata", "low_shibata", "high_shibata",
+		"f_weighted", "e_weighted", "modified_e_weighted",
+	}
+)
+
+// Profile describes the output format of the transcoded files.
+type Profile struct {
+	Codec         string  `yaml:"codec"`
+	Bitrate       string  `yaml:"bitrate"`
+	MaxSampleRate int     `yaml:"max_sample_rate"`
+	MaxBitDepth   int     `yaml:"max_bit_depth"`
+	DSP           DSP     `yaml:"dsp"`
+	Downmix       Downmix `yaml:"downmix"`
+	// Filters is an ordered list of ffmpeg audio filters (EQ, crossfeed
+	// and so on) applied to the source before resampling and dithering.
+	Filters []string `yaml:"filters"`
+}
+
+// Downmix describes how the sources with other than two channels are handled.
+// Multichannel sources are always downmixed to stereo.
+type Downmix struct {
+	// Mono is either "keep" to leave mono sources as is or "stereo" to
+	// duplicate the channel.
+	Mono string `yaml:"mono"`
+	// Levels of the channels in the stereo mix.
+	Center   *float64 `yaml:"center"`
+	Surround *float64 `yaml:"surround"`
+	LFE      float64  `yaml:"lfe"`
+	// DialogueBoost is an extra center channel gain in dB.
+	DialogueBoost float64 `yaml:"dialogue_boost"`
+	// Left and right are custom ffmpeg pan filter expressions for the
+	// output channels, e.g. "0.5*FL+0.35*FC+0.35*SL". They override the
+	// levels above when both are set.
+	Left  string `yaml:"left"`
+	Right string `yaml:"right"`
+}
+
+// DSP describes how the audio is resampled and requantized for the profile.
+type DSP struct {
+	RateFamily   string `yaml:"rate_family"`
+	Resampler    string `yaml:"resampler"`
+	Precision    int    `yaml:"precision"`
+	Dither       string `yaml:"dither"`
+	NoiseShaping string `yaml:"noise_shaping"`
+}
+
+// BitsPerSecond returns the bitrate in bits per second. Like ffmpeg, it
+// understands the k and M suffixes. It returns zero if the bitrate isn't set
+// or can't be parsed.
+func (p *Profile) BitsPerSecond() int {
+	value, multiplier := p.Bitrate, 1.0
+
+	switch {
+	case strings.HasSuffix(value, "k"):
+		value, multiplier = strings.TrimSuffix(value, "k"), 1e3
+	case strings.HasSuffix(value, "M"):
+		value, multiplier = strings.TrimSuffix(value, "M"), 1e6
+	}
+
+	bitrate, err := strconv.ParseFloat(value, 64)
+	if err != nil || bitrate <= 0 {
+		return 0
+	}
+
+	return int(bitrate * multiplier)
+}
+
+// ActiveProfile returns the name and settings of the profile used for transcoding.
+func (t *Transcoding) ActiveProfile() (string, Profile) {
+	return t.Profile, t.Profiles[t.Profile]
+}
+
+func (t *Transcoding) applyDefaults() {
+	if t.Profile == "" {
+		t.Profile = DefaultProfileName
+	}
+
+	if t.Profiles == nil {
+		t.Profiles = make(map[string]Profile)
+	}
+
+	if _, ok := t.Profiles[DefaultProfileName]; !ok {
+		t.Profiles[DefaultProfileName] = Profile{}
+	}
+
+	for name, profile := range t.Profiles {
+		profile.applyDefaults()
+		t.Profiles[name] = profile
+	}
+}
+
+func (t *Transcoding) validate() error {
+	if _, ok := t.Profiles[t.Profile]; !ok {
+		return fmt.Errorf("%w: %w (%s)", ErrConfiguration, ErrUnknownProfile, t.Profile)
+	}
+
+	for name, profile := range t.Profiles {
+		err := profile.validate(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Profile) applyDefaults() {
+	if p.Codec == "" {
+		p.Codec = CodecALAC
+	}
+
+	if p.Codec == CodecAAC && p.Bitrate == "" {
+		p.Bitrate = "256k"
+	}
+
+	if p.MaxSampleRate == 0 {
+		p.MaxSampleRate = 48000
+	}
+
+	if p.MaxBitDepth == 0 {
+		p.MaxBitDepth = 16
+	}
+
+	if p.DSP.RateFamily == "" {
+		p.DSP.RateFamily = RateFamilySource
+	}
+
+	if p.DSP.Resampler == "" {
+		p.DSP.Resampler = ResamplerSoXR
+	}
+
+	if p.DSP.Precision == 0 {
+		p.DSP.Precision = 28
+	}
+
+	if p.DSP.Dither == "" {
+		p.DSP.Dither = "triangular"
+	}
+
+	if p.DSP.NoiseShaping == "" {
+		p.DSP.NoiseShaping = DitherNone
+	}
+
+	if p.Downmix.Mono == "" {
+		p.Downmix.Mono = MonoKeep
+	}
+
+	if p.Downmix.Center == nil {
+		center := defaultCenterLevel
+		p.Downmix.Center = &center
+	}
+
+	if p.Downmix.Surround == nil {
+		surround := defaultSurroundLevel
+		p.Downmix.Surround = &surround
+	}
+}
+
+func (p *Profile) validate(name string) error {
+	if p.Codec != CodecALAC && p.Codec != CodecAAC {
+		return invalidProfile(name, "unsupported codec %q", p.Codec)
+	}
+
+	if p.Codec == CodecAAC && p.BitsPerSecond() == 0 {
+		return invalidProfile(name, "invalid bitrate %q", p.Bitrate)
+	}
+
+	if p.MaxSampleRate < 8000 {
+		return invalidProfile(name, "max sample rate %d is too low", p.MaxSampleRate)
+	}
+
+	if p.MaxBitDepth != 16 && p.MaxBitDepth != 24 {
+		return invalidProfile(name, "max bit depth must be 16 or 24, got %d", p.MaxBitDepth)
+	}
+
+	if !slices.Contains([]string{RateFamilySource, RateFamily44100, RateFamily48000}, p.DSP.RateFamily) {
+		return invalidProfile(name, "unknown sample rate family %q", p.DSP.RateFamily)
+	}
+
+	if p.DSP.Resampler != ResamplerSoXR && p.DSP.Resampler != ResamplerSWR {
+		return invalidProfile(name, "unknown resampler %q", p.DSP.Resampler)
+	}
+
+	// That's the range soxr accepts, swr ignores the precision.
+	if p.DSP.Precision < 15 || p.DSP.Precision > 33 {
+		return invalidProfile(
+			name, "resampler precision must be between 15 and 33 bits, got %d", p.DSP.Precision,
+		)
+	}
+
+	if !slices.Contains(dithers, p.DSP.Dither) {
+		return invalidProfile(name, "unknown dither %q", p.DSP.Dither)
+	}
+
+	if !slices.Contains(noiseShapings, p.DSP.NoiseShaping) {
+		return invalidProfile(name, "unknown noise shaping %q", p.DSP.NoiseShaping)
+	}
+
+	err := p.Downmix.validate(name)
+	if err != nil {
+		return err
+	}
+
+	for i, filter := range p.Filters {
+		if strings.TrimSpace(filter) == "" {
+			return invalidProfile(name, "filter #%d is empty", i+1)
+		}
+	}
+
+	return nil
+}
+
+func (d *Downmix) validate(profileName string) error {
+	if d.Mono != MonoKeep && d.Mono != MonoStereo {
+		return invalidProfile(
+			profileName, "mono handling must be %q or %q, got %q", MonoKeep, MonoStereo, d.Mono,
+		)
+	}
+
+	levels := map[string]float64{"center": *d.Center, "surround": *d.Surround, "lfe": d.LFE}
+	for channel, level := range levels {
+		if level < 0 || level > maxMixLevel {
+			return invalidProfile(
+				profileName, "%s downmix level must be between 0 and %d, got %g", channel, maxMixLevel, level,
+			)
+		}
+	}
+
+	if d.DialogueBoost < 0 || d.DialogueBoost > maxDialogueBoost {
+		return invalidProfile(
+			profileName, "dialogue boost must be between 0 and %d dB, got %g", maxDialogueBoost, d.DialogueBoost,
+		)
+	}
+
+	if (d.Left == "") != (d.Right == "") {
+		return invalidProfile(profileName, "custom downmix needs both left and right expressions")
+	}
+
+	return nil
+}
+
+func invalidProfile(name, format string, args ...any) error {
+	return fmt.Errorf(
+		"%w: %w (%s)", ErrConfiguration, ErrInvalidProfile,
+		fmt.Sprintf("profile %q: ", name)+fmt.Sprintf(format, args...),
+	)
+}
@@ -0,0 +1,26 @@
+package configuration
+
+import "fmt"
+
+const DefaultSearchMaxResults = 1000
+
+// Search shows the tracks matching the queries in the .search directory of
+// the mount.
+type Search struct {
+	Enabled    bool `yaml:"enabled"`
+	MaxResults int  `yaml:"max_results"`
+}
+
+func (s *Search) applyDefaults() {
+	if s.MaxResults == 0 {
+		s.MaxResults = DefaultSearchMaxResults
+	}
+}
+
+func (s *Search) validate() error {
+	if s.MaxResults < 1 {
+		return fmt.Errorf("%w: %w (max_results must be positive, got %d)", ErrConfiguration, ErrInvalidSearch, s.MaxResults)
+	}
+
+	return nil
+}
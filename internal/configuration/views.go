@@ -0,0 +1,34 @@
+package configuration
+
+import "fmt"
+
+const DefaultRecentDays = 30
+
+// Views are the read-only top-level directories showing the library grouped
+// by the track tags, next to the main tree.
+type Views struct {
+	ByGenre       bool `yaml:"by_genre"`
+	ByYear        bool `yaml:"by_year"`
+	ByArtist      bool `yaml:"by_artist"`
+	RecentlyAdded bool `yaml:"recently_added"`
+	RecentDays    int  `yaml:"recent_days"`
+}
+
+// Enabled returns true if any view is shown.
+func (v *Views) Enabled() bool {
+	return v.ByGenre || v.ByYear || v.ByArtist || v.RecentlyAdded
+}
+
+func (v *Views) applyDefaults() {
+	if v.RecentDays == 0 {
+		v.RecentDays = DefaultRecentDays
+	}
+}
+
+func (v *Views) validate() error {
+	if v.RecentDays < 1 {
+		return fmt.Errorf("%w: %w (recent_days must be positive, got %d)", ErrConfiguration, ErrInvalidViews, v.RecentDays)
+	}
+
+	return nil
+}
@@ -5,6 +5,8 @@ import "source.hodakov.me/hdkv/faketunes/internal/domains/cacher/dto"
 const CacherName = "cacher"
 
 type Cacher interface {
-	GetStat(sourcePath string) (int64, error)
+	GetStat(sourcePath string) (*dto.FileStat, error)
 	GetFileDTO(sourcePath string) (*dto.CacheItem, error)
+	GetCacheInfo(sourcePath string) (*dto.CacheInfo, error)
+	Invalidate(sourcePath string)
 }
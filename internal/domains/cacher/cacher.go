@@ -1,8 +1,10 @@
 package cacher
 
 import (
+	"container/list"
 	"fmt"
 	"sync"
+	"time"
 
 	"source.hodakov.me/hdkv/faketunes/internal/application"
 	"source.hodakov.me/hdkv/faketunes/internal/domains"
@@ -17,24 +19,46 @@ var (
 type Cacher struct {
 	app *application.App
 
+	checker    domains.Checker
 	transcoder domains.Transcoder
 
 	cacheDir    string
 	currentSize int64
 	maxSize     int64
 	items       map[string]*models.CacheItem
+	transcoding map[string]chan struct{}
 	itemsMutex  sync.RWMutex
-	stat        map[string]*models.CacherStat
-	statMutex   sync.RWMutex
+
+	stat           map[string]*list.Element
+	statLRU        *list.List
+	statMaxEntries int
+	statTTL        time.Duration
+	statHits       int64
+	statMisses     int64
+	statMutex      sync.Mutex
 }
 
 func New(app *application.App) *Cacher {
+	statMaxEntries := app.Config().FakeTunes.StatCache.MaxEntries
+	if statMaxEntries <= 0 {
+		statMaxEntries = defaultStatCacheMaxEntries
+	}
+
+	statTTL := app.Config().FakeTunes.StatCache.TTL
+	if statTTL <= 0 {
+		statTTL = defaultStatCacheTTL
+	}
+
 	return &Cacher{
-		app:      app,
-		cacheDir: app.Config().Paths.Destination + "/.cache",
-		maxSize:  app.Config().FakeTunes.CacheSize * 1024 * 1024,
-		items:    make(map[string]*models.CacheItem, 0),
-		stat:     make(map[string]*models.CacherStat, 0),
+		app:            app,
+		cacheDir:       app.Config().Paths.Destination + "/.cache",
+		maxSize:        app.Config().FakeTunes.CacheSize * 1024 * 1024,
+		items:          make(map[string]*models.CacheItem, 0),
+		transcoding:    make(map[string]chan struct{}, 0),
+		stat:           make(map[string]*list.Element, 0),
+		statLRU:        list.New(),
+		statMaxEntries: statMaxEntries,
+		statTTL:        statTTL,
 	}
 }
 
@@ -49,9 +73,28 @@ func (c *Cacher) ConnectDependencies() error {
 
 	c.transcoder = transcoder
 
+	checker, ok := c.app.RetrieveDomain(domains.CheckerName).(domains.Checker)
+	if !ok {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrCacher, ErrConnectDependencies,
+			"checker domain interface conversion failed",
+		)
+	}
+
+	c.checker = checker
+
 	return nil
 }
 
 func (c *Cacher) Start() error {
+	wg := c.app.GetGlobalWaitGroup()
+	if wg == nil {
+		return fmt.Errorf("%w: %w (%s)", ErrCacher, ErrFailedToGetWaitGroup, "got nil waitgroup")
+	}
+
+	wg.Go(func() {
+		c.reportStatCache()
+	})
+
 	return nil
 }
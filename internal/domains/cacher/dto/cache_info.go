@@ -0,0 +1,17 @@
+package dto
+
+import "time"
+
+const (
+	CacheStateCached  = "cached"
+	CacheStateMissing = "missing"
+	CacheStateCorrupt = "corrupt source"
+)
+
+// CacheInfo is representing the cache state of a source file's current version.
+type CacheInfo struct {
+	Key        string
+	State      string
+	Transcoded time.Time
+	Profile    string
+}
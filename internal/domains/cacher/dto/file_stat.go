@@ -0,0 +1,9 @@
+package dto
+
+import "time"
+
+// FileStat is representing the attributes of a virtual transcoded file.
+type FileStat struct {
+	Size    int64
+	ModTime time.Time
+}
@@ -5,7 +5,9 @@ import "errors"
 var (
 	ErrCacher                   = errors.New("cacher")
 	ErrConnectDependencies      = errors.New("failed to connect dependencies")
+	ErrFailedToGetWaitGroup     = errors.New("failed to get global waitgroup")
 	ErrFailedToDeleteCachedFile = errors.New("failed to delete cached file")
 	ErrFailedToGetSourceFile    = errors.New("failed to get source file")
 	ErrFailedToTranscodeFile    = errors.New("failed to transcode file")
+	ErrCorruptSourceFile        = errors.New("source file is known to be corrupt")
 )
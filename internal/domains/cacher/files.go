@@ -8,6 +8,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/sirupsen/logrus"
 	"source.hodakov.me/hdkv/faketunes/internal/domains/cacher/dto"
 	"source.hodakov.me/hdkv/faketunes/internal/domains/cacher/models"
 )
@@ -30,10 +31,18 @@ func (c *Cacher) getFile(sourcePath string) (*models.CacheItem, error) {
 		return nil, fmt.Errorf("%w: %w (%w)", ErrCacher, ErrFailedToGetSourceFile, err)
 	}
 
-	keyData := fmt.Sprintf("%s:%d", sourcePath, sourceFileInfo.ModTime().UnixNano())
-	hash := md5.Sum([]byte(keyData))
-	cacheKey := hex.EncodeToString(hash[:])
-	cacheFilePath := filepath.Join(c.cacheDir, cacheKey+".m4a")
+	// Don't hand a truncated ALAC to the client.
+	if reason, corrupt := c.checker.KnownCorrupt(sourcePath); corrupt {
+		c.app.Logger().WithFields(logrus.Fields{
+			"source file": sourcePath,
+			"reason":      reason,
+		}).Error("Refusing to serve the source file found corrupt by integrity check")
+
+		return nil, fmt.Errorf("%w: %w (%s)", ErrCacher, ErrCorruptSourceFile, reason)
+	}
+
+	cacheKey := c.cacheKey(sourcePath, sourceFileInfo.ModTime())
+	cacheFilePath := c.cacheFilePath(cacheKey)
 
 	c.itemsMutex.Lock()
 
@@ -44,7 +53,7 @@ func (c *Cacher) getFile(sourcePath string) (*models.CacheItem, error) {
 			item.Updated = time.Now().UTC()
 			c.itemsMutex.Unlock()
 
-			c.updateCachedStat(sourcePath, item.Size)
+			c.updateCachedStat(sourcePath, sourceFileInfo.ModTime(), item.Size)
 
 			return item, nil
 		}
@@ -58,48 +67,93 @@ func (c *Cacher) getFile(sourcePath string) (*models.CacheItem, error) {
 		if cachedFileInfo.ModTime().After(sourceFileInfo.ModTime()) &&
 			cachedFileInfo.Size() > 1024 {
 			item := &models.CacheItem{
-				Path:    cacheFilePath,
-				Size:    cachedFileInfo.Size(),
-				Updated: time.Now().UTC(),
+				SourcePath: sourcePath,
+				Path:       cacheFilePath,
+				Size:       cachedFileInfo.Size(),
+				Updated:    time.Now().UTC(),
 			}
 			c.items[cacheKey] = item
 			c.currentSize += cachedFileInfo.Size()
 			c.itemsMutex.Unlock()
 
-			c.updateCachedStat(sourcePath, item.Size)
+			c.updateCachedStat(sourcePath, sourceFileInfo.ModTime(), item.Size)
 
 			return item, nil
 		}
 	}
 
-	// File does not exist on disk, need to transcode.
-	// Register in the queue
-	c.transcoder.QueueChannel() <- struct{}{}
+	// Another open is transcoding the same file already, wait for it.
+	if done, ok := c.transcoding[cacheKey]; ok {
+		c.itemsMutex.Unlock()
+		<-done
+
+		return c.getFile(sourcePath)
+	}
+
+	// File does not exist on disk, need to transcode. The transcode waits
+	// for its queue slot without holding the lock, so the cached files are
+	// served meanwhile.
+	done := make(chan struct{})
+	c.transcoding[cacheKey] = done
+	c.itemsMutex.Unlock()
 
 	defer func() {
-		<-c.transcoder.QueueChannel()
+		c.itemsMutex.Lock()
+		delete(c.transcoding, cacheKey)
+		c.itemsMutex.Unlock()
+		close(done)
 	}()
 
+	// Register in the queue
+	c.transcoder.QueueChannel() <- struct{}{}
+
 	// Convert file
 	size, err := c.transcoder.Convert(sourcePath, cacheFilePath)
+
+	<-c.transcoder.QueueChannel()
+
 	if err != nil {
-		c.itemsMutex.Unlock()
 		return nil, fmt.Errorf("%w: %w (%w)", ErrCacher, ErrFailedToTranscodeFile, err)
 	}
 
 	// Add converted file information to cache
 	item := &models.CacheItem{
-		Path:    cacheFilePath,
-		Size:    size,
-		Updated: time.Now(),
+		SourcePath: sourcePath,
+		Path:       cacheFilePath,
+		Size:       size,
+		Updated:    time.Now(),
 	}
+
+	c.itemsMutex.Lock()
 	c.items[cacheKey] = item
 	c.currentSize += size
 	c.itemsMutex.Unlock()
 
-	c.updateCachedStat(sourcePath, size)
-	// TODO: run cleanup on inotify events.
-	c.cleanup()
+	c.updateCachedStat(sourcePath, sourceFileInfo.ModTime(), size)
+
+	c.itemsMutex.Lock()
+	err = c.cleanup()
+	c.itemsMutex.Unlock()
+
+	if err != nil {
+		c.app.Logger().WithError(err).Error("Failed to clean up cache")
+	}
 
 	return item, nil
 }
+
+// cacheKey returns the key of the transcoded source file version in cache.
+// It depends on the transcoding profile, so files transcoded with different
+// profile settings are never mixed up.
+func (c *Cacher) cacheKey(sourcePath string, sourceModTime time.Time) string {
+	keyData := fmt.Sprintf(
+		"%s:%d:%s", sourcePath, sourceModTime.UnixNano(), c.transcoder.ProfileKey(),
+	)
+	hash := md5.Sum([]byte(keyData))
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (c *Cacher) cacheFilePath(cacheKey string) string {
+	return filepath.Join(c.cacheDir, cacheKey+".m4a")
+}
@@ -0,0 +1,40 @@
+package cacher
+
+import (
+	"fmt"
+	"os"
+
+	"source.hodakov.me/hdkv/faketunes/internal/domains/cacher/dto"
+)
+
+// GetCacheInfo returns the cache state of the source file without triggering
+// conversion.
+func (c *Cacher) GetCacheInfo(sourcePath string) (*dto.CacheInfo, error) {
+	sourceFileInfo, err := os.Stat(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrCacher, ErrFailedToGetSourceFile, err)
+	}
+
+	cacheKey := c.cacheKey(sourcePath, sourceFileInfo.ModTime())
+	info := &dto.CacheInfo{
+		Key:     cacheKey,
+		State:   dto.CacheStateMissing,
+		Profile: c.transcoder.ProfileKey(),
+	}
+
+	if _, corrupt := c.checker.KnownCorrupt(sourcePath); corrupt {
+		info.State = dto.CacheStateCorrupt
+
+		return info, nil
+	}
+
+	// Same validity rules as for serving the file.
+	cachedFileInfo, err := os.Stat(c.cacheFilePath(cacheKey))
+	if err == nil && cachedFileInfo.ModTime().After(sourceFileInfo.ModTime()) &&
+		cachedFileInfo.Size() > 1024 {
+		info.State = dto.CacheStateCached
+		info.Transcoded = cachedFileInfo.ModTime()
+	}
+
+	return info, nil
+}
@@ -0,0 +1,44 @@
+package cacher
+
+import (
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Invalidate forgets the cached information about the source file and
+// removes the transcoded versions of it that no longer match the source.
+// It's safe to call for deleted sources and for directories.
+func (c *Cacher) Invalidate(sourcePath string) {
+	c.forgetCachedStat(sourcePath)
+
+	currentKey := ""
+	if info, err := os.Stat(sourcePath); err == nil && !info.IsDir() {
+		currentKey = c.cacheKey(sourcePath, info.ModTime())
+	}
+
+	c.itemsMutex.Lock()
+	defer c.itemsMutex.Unlock()
+
+	for key, item := range c.items {
+		if item.SourcePath != sourcePath || key == currentKey {
+			continue
+		}
+
+		err := os.Remove(item.Path)
+		if err != nil && !os.IsNotExist(err) {
+			c.app.Logger().WithError(err).WithField("path", item.Path).
+				Error("Failed to delete stale cached file")
+
+			continue
+		}
+
+		delete(c.items, key)
+		c.currentSize -= item.Size
+
+		c.app.Logger().WithFields(logrus.Fields{
+			"source file": sourcePath,
+			"path":        item.Path,
+		}).Debug("Removed stale cached file")
+	}
+}
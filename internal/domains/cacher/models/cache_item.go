@@ -7,9 +7,10 @@ import (
 )
 
 type CacheItem struct {
-	Path    string
-	Size    int64
-	Updated time.Time
+	SourcePath string
+	Path       string
+	Size       int64
+	Updated    time.Time
 }
 
 func CacheItemModelToDTO(item *CacheItem) *dto.CacheItem {
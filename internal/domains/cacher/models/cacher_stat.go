@@ -3,7 +3,10 @@ package models
 import "time"
 
 // CacherStat is representing information about a single object size in cache.
+// It's valid only for the source file version with the same modification time.
 type CacherStat struct {
-	Size    int64
-	Created time.Time
+	SourcePath    string
+	SourceModTime time.Time
+	Size          int64
+	Created       time.Time
 }
@@ -1,65 +1,154 @@
 package cacher
 
 import (
-	"crypto/md5"
-	"encoding/hex"
-	"fmt"
+	"container/list"
 	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/cacher/dto"
 	"source.hodakov.me/hdkv/faketunes/internal/domains/cacher/models"
 )
 
-// getStat returns file size without triggering conversion (for ls/stat).
-func (c *Cacher) GetStat(sourcePath string) (int64, error) {
-	if size, ok := c.getCachedStat(sourcePath); ok {
-		return size, nil
-	}
+const (
+	defaultStatCacheMaxEntries = 100000
+	defaultStatCacheTTL        = time.Hour
+	statCacheReportInterval    = 10 * time.Minute
+)
 
-	// Check if we have a cached converted file
+// GetStat returns file size and modification time without triggering
+// conversion (for ls/stat). The modification time is always the source file's
+// one, so it stays the same until the source file is changed.
+func (c *Cacher) GetStat(sourcePath string) (*dto.FileStat, error) {
 	info, err := os.Stat(sourcePath)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	keyData := fmt.Sprintf("%s:%d", sourcePath, info.ModTime().UnixNano())
-	hash := md5.Sum([]byte(keyData))
-	key := hex.EncodeToString(hash[:])
-	cachePath := filepath.Join(c.cacheDir, key+".m4a")
+	if stat, ok := c.getCachedStat(sourcePath, info.ModTime()); ok {
+		return stat, nil
+	}
+
+	cachePath := c.cacheFilePath(c.cacheKey(sourcePath, info.ModTime()))
 
 	// Check if converted file exists and is valid
 	if cacheInfo, err := os.Stat(cachePath); err == nil {
 		if cacheInfo.ModTime().After(info.ModTime()) && cacheInfo.Size() > 1024 {
-			c.updateCachedStat(sourcePath, cacheInfo.Size())
+			c.updateCachedStat(sourcePath, info.ModTime(), cacheInfo.Size())
 
-			return cacheInfo.Size(), nil
+			return &dto.FileStat{
+				Size:    cacheInfo.Size(),
+				ModTime: info.ModTime(),
+			}, nil
 		}
 	}
 
 	// Return estimated size (FLAC file size as placeholder)
-	return info.Size(), nil
+	return &dto.FileStat{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// updateCachedStat updates the stat cache, evicting the least recently used
+// entries when it's full.
+func (c *Cacher) updateCachedStat(sourcePath string, sourceModTime time.Time, size int64) {
+	c.statMutex.Lock()
+	defer c.statMutex.Unlock()
+
+	stat := &models.CacherStat{
+		SourcePath:    sourcePath,
+		SourceModTime: sourceModTime,
+		Size:          size,
+		Created:       time.Now(),
+	}
+
+	if element, ok := c.stat[sourcePath]; ok {
+		element.Value = stat
+		c.statLRU.MoveToFront(element)
+
+		return
+	}
+
+	c.stat[sourcePath] = c.statLRU.PushFront(stat)
+
+	for c.statLRU.Len() > c.statMaxEntries {
+		c.removeCachedStat(c.statLRU.Back())
+	}
+}
+
+// getCachedStat returns cached file stats if they were gathered for the same
+// source file version and haven't expired.
+func (c *Cacher) getCachedStat(sourcePath string, sourceModTime time.Time) (*dto.FileStat, bool) {
+	c.statMutex.Lock()
+	defer c.statMutex.Unlock()
+
+	element, ok := c.stat[sourcePath]
+	if !ok {
+		c.statMisses++
+
+		return nil, false
+	}
+
+	stat, _ := element.Value.(*models.CacherStat)
+	if !stat.SourceModTime.Equal(sourceModTime) || time.Since(stat.Created) > c.statTTL {
+		c.removeCachedStat(element)
+		c.statMisses++
+
+		return nil, false
+	}
+
+	c.statLRU.MoveToFront(element)
+	c.statHits++
+
+	return &dto.FileStat{
+		Size:    stat.Size,
+		ModTime: stat.SourceModTime,
+	}, true
 }
 
-// updateCachedStat updates the stat cache.
-func (c *Cacher) updateCachedStat(sourcePath string, size int64) {
+// forgetCachedStat removes the source file stats from the stat cache.
+func (c *Cacher) forgetCachedStat(sourcePath string) {
 	c.statMutex.Lock()
 	defer c.statMutex.Unlock()
 
-	c.stat[sourcePath] = &models.CacherStat{
-		Size:    size,
-		Created: time.Now(),
+	if element, ok := c.stat[sourcePath]; ok {
+		c.removeCachedStat(element)
 	}
 }
 
-// getCachedStat returns cached file stats.
-func (c *Cacher) getCachedStat(sourcePath string) (int64, bool) {
-	c.statMutex.RLock()
-	defer c.statMutex.RUnlock()
+// removeCachedStat removes the stat cache entry. Must be called with
+// statMutex held.
+func (c *Cacher) removeCachedStat(element *list.Element) {
+	stat, _ := c.statLRU.Remove(element).(*models.CacherStat)
+	delete(c.stat, stat.SourcePath)
+}
+
+// reportStatCache periodically logs the stat cache usage until the
+// application is stopped.
+func (c *Cacher) reportStatCache() {
+	ticker := time.NewTicker(statCacheReportInterval)
+	defer ticker.Stop()
 
-	if stat, ok := c.stat[sourcePath]; ok {
-		return stat.Size, true
+	for {
+		select {
+		case <-c.app.Context().Done():
+			c.logStatCache()
+
+			return
+		case <-ticker.C:
+			c.logStatCache()
+		}
 	}
+}
+
+func (c *Cacher) logStatCache() {
+	c.statMutex.Lock()
+	defer c.statMutex.Unlock()
 
-	return 0, false
+	c.app.Logger().WithFields(logrus.Fields{
+		"entries": c.statLRU.Len(),
+		"hits":    c.statHits,
+		"misses":  c.statMisses,
+	}).Debug("Stat cache usage")
 }
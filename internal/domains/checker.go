@@ -0,0 +1,10 @@
+package domains
+
+import "source.hodakov.me/hdkv/faketunes/internal/domains/checker/dto"
+
+const CheckerName = "checker"
+
+type Checker interface {
+	CheckLibrary(full bool) (*dto.CheckSummary, error)
+	KnownCorrupt(sourcePath string) (string, bool)
+}
@@ -0,0 +1,169 @@
+package checker
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/checker/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/checker/models"
+)
+
+// saveReportEvery is the amount of checked files after which the report is
+// flushed to disk, so an interrupted check doesn't have to start over.
+const saveReportEvery = 100
+
+// CheckLibrary decodes every source FLAC file and records the results in the
+// persistent integrity report. Unless full is set, files that weren't changed
+// since the last check are skipped.
+func (c *Checker) CheckLibrary(full bool) (*dto.CheckSummary, error) {
+	c.libraryCheckLock.Lock()
+	defer c.libraryCheckLock.Unlock()
+
+	err := c.loadReport()
+	if err != nil {
+		return nil, err
+	}
+
+	c.app.Logger().WithFields(logrus.Fields{
+		"source directory": c.sourceDir,
+		"full check":       full,
+	}).Info("Checking source library integrity...")
+
+	summary := new(dto.CheckSummary)
+	seen := make(map[string]struct{}, 0)
+	unsaved := 0
+
+	err = filepath.WalkDir(c.sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".flac") {
+			return nil
+		}
+
+		if err := c.app.Context().Err(); err != nil {
+			return err
+		}
+
+		seen[path] = struct{}{}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		c.reportMutex.RLock()
+		previous, ok := c.report[path]
+		c.reportMutex.RUnlock()
+
+		if !full && ok && c.isUpToDate(previous, info) {
+			summary.Skipped++
+
+			return nil
+		}
+
+		c.checkFile(path, info, summary)
+
+		unsaved++
+		if unsaved >= saveReportEvery {
+			unsaved = 0
+
+			if err := c.saveReport(); err != nil {
+				c.app.Logger().WithError(err).Warn("Failed to save intermediate integrity report")
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		// Keep the progress made so far.
+		_ = c.saveReport()
+
+		return summary, fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToWalkLibrary, err)
+	}
+
+	// Forget about the files that are gone from the library.
+	c.reportMutex.Lock()
+	for path := range c.report {
+		if _, ok := seen[path]; !ok {
+			delete(c.report, path)
+		}
+	}
+	c.reportMutex.Unlock()
+
+	err = c.saveReport()
+	if err != nil {
+		return summary, err
+	}
+
+	c.app.Logger().WithFields(logrus.Fields{
+		"checked": summary.Checked,
+		"skipped": summary.Skipped,
+		"corrupt": summary.Corrupt,
+		"failed":  summary.Failed,
+	}).Info("Source library integrity check finished")
+
+	return summary, nil
+}
+
+func (c *Checker) checkFile(path string, info fs.FileInfo, summary *dto.CheckSummary) {
+	c.checkQueue <- struct{}{}
+	check, err := c.transcoder.CheckSource(path)
+	<-c.checkQueue
+
+	if err != nil {
+		summary.Failed++
+
+		c.app.Logger().WithError(err).WithField("source file", path).Error("Failed to check source file")
+
+		return
+	}
+
+	summary.Checked++
+
+	if check.Corrupt {
+		summary.Corrupt++
+
+		c.app.Logger().WithFields(logrus.Fields{
+			"source file": path,
+			"reason":      check.Reason,
+		}).Error("Source file is corrupt")
+	}
+
+	c.reportMutex.Lock()
+	c.report[path] = &models.CheckResult{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		CheckedAt: time.Now().UTC(),
+		Corrupt:   check.Corrupt,
+		Reason:    check.Reason,
+	}
+	c.reportMutex.Unlock()
+}
+
+// runBackgroundChecks periodically checks the files that were added or
+// changed since the previous check until the application is stopped.
+func (c *Checker) runBackgroundChecks() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := c.CheckLibrary(false)
+		if err != nil && c.app.Context().Err() == nil {
+			c.app.Logger().WithError(err).Error("Background integrity check failed")
+		}
+
+		select {
+		case <-c.app.Context().Done():
+			c.app.Logger().Debug("Application context cancelled, stopping integrity checks...")
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
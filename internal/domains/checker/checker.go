@@ -0,0 +1,92 @@
+package checker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/application"
+	"source.hodakov.me/hdkv/faketunes/internal/domains"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/checker/models"
+)
+
+const (
+	defaultCheckInterval = 24 * time.Hour
+	// checkConcurrency limits the parallel source decodes. The checks don't
+	// take the transcoding slots, so the clients never wait for them.
+	checkConcurrency = 1
+)
+
+var (
+	_ domains.Checker = new(Checker)
+	_ domains.Domain  = new(Checker)
+)
+
+type Checker struct {
+	app *application.App
+
+	transcoder domains.Transcoder
+
+	sourceDir  string
+	reportPath string
+	interval   time.Duration
+	checkQueue chan struct{}
+
+	report           map[string]*models.CheckResult
+	reportMutex      sync.RWMutex
+	reportLoadOnce   sync.Once
+	reportLoadErr    error
+	libraryCheckLock sync.Mutex
+}
+
+func New(app *application.App) *Checker {
+	interval := app.Config().Checker.Interval
+	if interval <= 0 {
+		interval = defaultCheckInterval
+	}
+
+	return &Checker{
+		app:        app,
+		sourceDir:  app.Config().Paths.Source,
+		reportPath: app.Config().Paths.Destination + "/.state/integrity.json",
+		interval:   interval,
+		checkQueue: make(chan struct{}, checkConcurrency),
+		report:     make(map[string]*models.CheckResult, 0),
+	}
+}
+
+func (c *Checker) ConnectDependencies() error {
+	transcoder, ok := c.app.RetrieveDomain(domains.TranscoderName).(domains.Transcoder)
+	if !ok {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrChecker, ErrConnectDependencies,
+			"transcoder domain interface conversion failed",
+		)
+	}
+
+	c.transcoder = transcoder
+
+	return nil
+}
+
+func (c *Checker) Start() error {
+	err := c.loadReport()
+	if err != nil {
+		return err
+	}
+
+	if !c.app.Config().Checker.Enabled {
+		return nil
+	}
+
+	wg := c.app.GetGlobalWaitGroup()
+	if wg == nil {
+		return fmt.Errorf("%w: %w (%s)", ErrChecker, ErrFailedToGetWaitGroup, "got nil waitgroup")
+	}
+
+	wg.Go(func() {
+		c.runBackgroundChecks()
+	})
+
+	return nil
+}
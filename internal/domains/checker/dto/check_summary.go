@@ -0,0 +1,9 @@
+package dto
+
+// CheckSummary is representing the results of a single library check run.
+type CheckSummary struct {
+	Checked int
+	Skipped int
+	Corrupt int
+	Failed  int
+}
@@ -0,0 +1,12 @@
+package checker
+
+import "errors"
+
+var (
+	ErrChecker              = errors.New("checker")
+	ErrConnectDependencies  = errors.New("failed to connect dependencies")
+	ErrFailedToGetWaitGroup = errors.New("failed to get global waitgroup")
+	ErrFailedToLoadReport   = errors.New("failed to load integrity report")
+	ErrFailedToSaveReport   = errors.New("failed to save integrity report")
+	ErrFailedToWalkLibrary  = errors.New("failed to walk source library")
+)
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// CheckResult is representing the integrity check result of a single source
+// file. Size and ModTime are used to tell if the result is still valid.
+type CheckResult struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"mod_time"`
+	CheckedAt time.Time `json:"checked_at"`
+	Corrupt   bool      `json:"corrupt"`
+	Reason    string    `json:"reason,omitempty"`
+}
@@ -0,0 +1,101 @@
+package checker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"source.hodakov.me/hdkv/faketunes/internal/domains/checker/models"
+)
+
+// KnownCorrupt reports whether the source file was found corrupt by the last
+// check and wasn't changed since then. It also returns the corruption reason.
+func (c *Checker) KnownCorrupt(sourcePath string) (string, bool) {
+	if c.loadReport() != nil {
+		return "", false
+	}
+
+	c.reportMutex.RLock()
+	result, ok := c.report[sourcePath]
+	c.reportMutex.RUnlock()
+
+	if !ok || !result.Corrupt {
+		return "", false
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil || !c.isUpToDate(result, info) {
+		return "", false
+	}
+
+	return result.Reason, true
+}
+
+func (c *Checker) isUpToDate(result *models.CheckResult, info os.FileInfo) bool {
+	return result.Size == info.Size() && result.ModTime.Equal(info.ModTime())
+}
+
+// loadReport reads the persistent integrity report once per application run.
+func (c *Checker) loadReport() error {
+	c.reportLoadOnce.Do(func() {
+		rawReport, err := os.ReadFile(c.reportPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return
+		}
+
+		if err != nil {
+			c.reportLoadErr = fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToLoadReport, err)
+
+			return
+		}
+
+		report := make(map[string]*models.CheckResult, 0)
+
+		err = json.Unmarshal(rawReport, &report)
+		if err != nil {
+			c.reportLoadErr = fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToLoadReport, err)
+
+			return
+		}
+
+		c.reportMutex.Lock()
+		c.report = report
+		c.reportMutex.Unlock()
+
+		c.app.Logger().WithField("entries", len(report)).Debug("Loaded integrity report")
+	})
+
+	return c.reportLoadErr
+}
+
+// saveReport atomically writes the integrity report to disk.
+func (c *Checker) saveReport() error {
+	c.reportMutex.RLock()
+	rawReport, err := json.MarshalIndent(c.report, "", "  ")
+	c.reportMutex.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToSaveReport, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.reportPath), 0o755)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToSaveReport, err)
+	}
+
+	tmpPath := c.reportPath + ".tmp"
+
+	err = os.WriteFile(tmpPath, rawReport, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToSaveReport, err)
+	}
+
+	err = os.Rename(tmpPath, c.reportPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrChecker, ErrFailedToSaveReport, err)
+	}
+
+	return nil
+}
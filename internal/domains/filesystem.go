@@ -2,4 +2,7 @@ package domains
 
 const FilesystemName = "filesystem"
 
-type Filesystem any
+type Filesystem interface {
+	InvalidateSource(sourcePath string)
+	MoveSource(oldPath, newPath string)
+}
@@ -0,0 +1,54 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// BackingFile is a read-only handle of a file on disk: the transcoded file in
+// cache or the source file served as is. On kernels supporting FUSE
+// passthrough the kernel reads the backing file directly, otherwise reads are
+// served from the file descriptor without any locking, so the clients reading
+// the same file never wait for each other.
+type BackingFile struct {
+	file *os.File
+	fd   int
+}
+
+var (
+	_ = (fs.FileReader)((*BackingFile)(nil))
+	_ = (fs.FileReleaser)((*BackingFile)(nil))
+	_ = (fs.FilePassthroughFder)((*BackingFile)(nil))
+)
+
+// PassthroughFd returns the backing file descriptor for the kernel to read
+// from. The kernel keeps using the same backing file for the inode while any
+// handle of it is open.
+func (bf *BackingFile) PassthroughFd() (int, bool) {
+	return bf.fd, true
+}
+
+func (bf *BackingFile) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	// The data is spliced or pread from the descriptor at offset when the
+	// reply is sent, so no shared file position is involved.
+	return fuse.ReadResultFd(uintptr(bf.fd), off, len(dest)), 0
+}
+
+func (bf *BackingFile) Release(ctx context.Context) syscall.Errno {
+	if err := bf.file.Close(); err != nil {
+		return syscall.EIO
+	}
+
+	return 0
+}
+
+func (f *FS) NewBackingFile(file *os.File) *BackingFile {
+	return &BackingFile{
+		file: file,
+		fd:   int(file.Fd()),
+	}
+}
@@ -3,8 +3,6 @@ package filesystem
 import (
 	"fmt"
 	"os"
-	"os/exec"
-	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -16,25 +14,16 @@ func (f *FS) prepareDirectories() error {
 
 	f.app.Logger().WithField("path", f.sourceDir).Info("Got source directory")
 
-	// Clean destination directory
-	if _, err := os.Stat(f.destinationDir); err == nil {
-		f.app.Logger().WithField("path", f.destinationDir).Info(
-			"Cleaning up the destination mountpoint",
-		)
-
-		// Try to unmount the destination FS if that was mounted before.
-		exec.Command("fusermount3", "-u", f.destinationDir).Run()
-		time.Sleep(5 * time.Second)
-
-		// Clean the destination
-		err := os.RemoveAll(f.destinationDir)
-		if err != nil {
-			return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToCleanupDestination, err)
-		}
+	// The destination must be an empty directory with nothing mounted on it.
+	err := f.prepareMountpoint()
+	if err != nil {
+		return err
 	}
 
 	// Create the structure for the virtual filesystem.
-	for _, dir := range []string{f.destinationDir, f.cacheDir, f.metadataDir} {
+	for _, dir := range []string{
+		f.destinationDir, f.cacheDir, f.metadataDir, f.stateDir, f.xattrDir,
+	} {
 		if err := os.MkdirAll(dir, 0o755); err != nil {
 			f.app.Logger().WithField("path", dir).Error("Operation on directory was unsuccessful")
 
@@ -47,6 +36,8 @@ func (f *FS) prepareDirectories() error {
 		"virtual filesystem mount": f.destinationDir,
 		"cache directory":          f.cacheDir,
 		"metadata directory":       f.metadataDir,
+		"state directory":          f.stateDir,
+		"xattr directory":          f.xattrDir,
 	}).Debug("Filesystem directories prepared")
 
 	return nil
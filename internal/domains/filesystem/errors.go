@@ -9,5 +9,14 @@ var (
 	ErrFailedToGetWaitGroup               = errors.New("failed to get global waitgroup")
 	ErrNoSource                           = errors.New("source does not exist")
 	ErrFailedToCleanupDestination         = errors.New("failed to clean up destination directory")
+	ErrDestinationNotEmpty                = errors.New("destination mountpoint is not empty")
+	ErrForeignMount                       = errors.New("destination mountpoint is used by another filesystem")
+	ErrFailedToUnmountStale               = errors.New("failed to unmount stale filesystem")
+	ErrFailedToReadMountInfo              = errors.New("failed to read mount information")
 	ErrFailedToCreateDestinationDirectory = errors.New("failed to create destination directory")
+	ErrFailedToLoadInodeTable             = errors.New("failed to load inode table")
+	ErrFailedToSaveInodeTable             = errors.New("failed to save inode table")
+	ErrFailedToLoadXattrs                 = errors.New("failed to load extended attributes")
+	ErrInvalidLayout                      = errors.New("invalid layout template")
+	ErrInvalidPlaylist                    = errors.New("invalid smart playlist")
 )
@@ -21,6 +21,7 @@ var (
 	_ = (fs.FileReader)((*File)(nil))
 	_ = (fs.FileWriter)((*File)(nil))
 	_ = (fs.FileFlusher)((*File)(nil))
+	_ = (fs.FileFsyncer)((*File)(nil))
 	_ = (fs.FileReleaser)((*File)(nil))
 )
 
@@ -53,7 +54,13 @@ func (fi *File) Write(ctx context.Context, data []byte, off int64) (written uint
 	return uint32(n), 0
 }
 
+// Flush is called on every close of the file descriptor, the data goes to
+// disk only on explicit Fsync.
 func (fi *File) Flush(ctx context.Context) syscall.Errno {
+	return 0
+}
+
+func (fi *File) Fsync(ctx context.Context, flags uint32) syscall.Errno {
 	fi.fileMutex.Lock()
 	defer fi.fileMutex.Unlock()
 
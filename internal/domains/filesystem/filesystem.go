@@ -2,9 +2,14 @@ package filesystem
 
 import (
 	"fmt"
+	"sync"
+	"sync/atomic"
 
 	"source.hodakov.me/hdkv/faketunes/internal/application"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
 	"source.hodakov.me/hdkv/faketunes/internal/domains"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/filesystem/models"
+	"source.hodakov.me/hdkv/faketunes/internal/pathtemplate"
 )
 
 var (
@@ -15,17 +20,65 @@ var (
 type FS struct {
 	app *application.App
 
-	cacher domains.Cacher
+	cacher  domains.Cacher
+	library domains.Library
 
 	sourceDir      string
 	destinationDir string
 	cacheDir       string
 	metadataDir    string
-
-	inodeCounter uint64
+	stateDir       string
+	inodeTablePath string
+	xattrDir       string
+
+	mountConfig     configuration.Mount
+	passthrough     configuration.Passthrough
+	names           configuration.Names
+	layoutConfig    configuration.Layout
+	viewsConfig     configuration.Views
+	searchConfig    configuration.Search
+	playlistsConfig configuration.Playlists
+	profile         configuration.Profile
+	metadataRules   *metadataRules
+
+	inodes      map[string]*models.InodeEntry
+	usedInodes  map[uint64]struct{}
+	inodesDirty bool
+	inodesMutex sync.Mutex
+
+	xattrs      map[string]map[string][]byte
+	xattrsMutex sync.RWMutex
+
+	nameIndexes      map[string]*nameIndex
+	nameIndexesMutex sync.Mutex
+
+	// layoutTemplate is set if the virtual tree is built from the tags.
+	layoutTemplate *pathtemplate.Template
+	views          layoutViews
+	playlists      []*smartPlaylist
+
+	// searchTemplate is set if the .search directory is shown.
+	searchTemplate *pathtemplate.Template
+	searches       map[string]*layoutTree
+	searchesMutex  sync.Mutex
+	layoutTree     atomic.Pointer[layoutTree]
+	layoutMutex    sync.Mutex
+
+	// layoutChanges are the changed source paths the kernel still has to be
+	// notified about in the layout tree.
+	layoutChanges      map[string]struct{}
+	layoutChangesMutex sync.Mutex
+
+	libraryStats      atomic.Pointer[models.LibraryStats]
+	libraryStatsDirty atomic.Bool
+
+	// root is set while the filesystem is mounted.
+	root atomic.Pointer[RootDirectory]
 }
 
 func New(app *application.App) *FS {
+	_, profile := app.Config().Transcoding.ActiveProfile()
+
 	return &FS{
 		app: app,
 
@@ -33,8 +86,28 @@ func New(app *application.App) *FS {
 		destinationDir: app.Config().Paths.Destination + "/Music",
 		cacheDir:       app.Config().Paths.Destination + "/.cache",
 		metadataDir:    app.Config().Paths.Destination + "/.metadata",
-
-		inodeCounter: 1000, // Start counting inodes after the reserved ones
+		stateDir:       app.Config().Paths.Destination + "/.state",
+		inodeTablePath: app.Config().Paths.Destination + "/.state/inodes.json",
+		xattrDir:       app.Config().Paths.Destination + "/.xattrs",
+
+		mountConfig:     app.Config().Mount,
+		passthrough:     app.Config().Passthrough,
+		names:           app.Config().Names,
+		layoutConfig:    app.Config().Layout,
+		viewsConfig:     app.Config().Views,
+		searchConfig:    app.Config().Search,
+		playlistsConfig: app.Config().Playlists,
+		profile:         profile,
+		metadataRules:   newMetadataRules(app.Config().Metadata),
+
+		inodes:     make(map[string]*models.InodeEntry, 0),
+		usedInodes: make(map[uint64]struct{}, 0),
+		xattrs:     make(map[string]map[string][]byte, 0),
+
+		nameIndexes: make(map[string]*nameIndex, 0),
+		searches:    make(map[string]*layoutTree, 0),
+
+		layoutChanges: make(map[string]struct{}, 0),
 	}
 }
 
@@ -49,6 +122,16 @@ func (f *FS) ConnectDependencies() error {
 
 	f.cacher = cacher
 
+	library, ok := f.app.RetrieveDomain(domains.LibraryName).(domains.Library)
+	if !ok {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrFilesystem, ErrConnectDependencies,
+			"library domain interface conversion failed",
+		)
+	}
+
+	f.library = library
+
 	return nil
 }
 
@@ -58,6 +141,40 @@ func (f *FS) Start() error {
 		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToPrepareDirectories, err)
 	}
 
+	if f.layoutConfig.Enabled() {
+		f.layoutTemplate, err = pathtemplate.Parse(f.layoutConfig.Template)
+		if err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrInvalidLayout, err)
+		}
+	}
+
+	f.views, err = newLayoutViews(f.viewsConfig)
+	if err != nil {
+		return err
+	}
+
+	f.playlists, err = newSmartPlaylists(f.playlistsConfig)
+	if err != nil {
+		return err
+	}
+
+	if f.searchConfig.Enabled {
+		f.searchTemplate, err = pathtemplate.Parse(searchTrackName)
+		if err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrInvalidLayout, err)
+		}
+	}
+
+	err = f.loadInodes()
+	if err != nil {
+		return err
+	}
+
+	err = f.loadXattrs()
+	if err != nil {
+		return err
+	}
+
 	wg := f.app.GetGlobalWaitGroup()
 	if wg == nil {
 		return fmt.Errorf("%w: %w (%s)", ErrFilesystem, ErrFailedToGetWaitGroup, "got nil waitgroup")
@@ -67,5 +184,19 @@ func (f *FS) Start() error {
 		f.mount()
 	})
 
+	wg.Go(func() {
+		f.persistInodes()
+	})
+
+	wg.Go(func() {
+		f.refreshLibraryStats()
+	})
+
+	if f.layoutTemplate != nil || f.hasViews() {
+		wg.Go(func() {
+			f.refreshLayout()
+		})
+	}
+
 	return nil
 }
@@ -1,7 +1,345 @@
 package filesystem
 
-import "sync/atomic"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
 
-func (f *FS) nextInode() uint64 {
-	return atomic.AddUint64(&f.inodeCounter, 1)
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/filesystem/models"
+)
+
+const (
+	// firstDynamicInode is the first inode number given to the filesystem
+	// objects, lower ones are reserved.
+	firstDynamicInode      = 1000
+	inodeTableSaveInterval = time.Minute
+)
+
+// stableAttr returns the stable attributes for the object backed by the file
+// at backingPath: source file or directory, or client metadata file.
+func (f *FS) stableAttr(backingPath string, mode uint32) fs.StableAttr {
+	ino, gen := f.inode(backingPath)
+
+	return fs.StableAttr{
+		Mode: mode,
+		Ino:  ino,
+		Gen:  gen,
+	}
+}
+
+// inode returns the inode and generation numbers for the object backed by
+// the file at backingPath. The numbers are derived from the path and stay
+// the same across lookups and restarts.
+func (f *FS) inode(backingPath string) (uint64, uint64) {
+	var device, inode uint64
+
+	if info, err := os.Stat(backingPath); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			device, inode = uint64(stat.Dev), stat.Ino
+		}
+	}
+
+	f.inodesMutex.Lock()
+	defer f.inodesMutex.Unlock()
+
+	entry, ok := f.inodes[backingPath]
+	if !ok {
+		entry = &models.InodeEntry{
+			Ino:    f.allocateInode(backingPath),
+			Gen:    1,
+			Device: device,
+			Inode:  inode,
+		}
+		f.inodes[backingPath] = entry
+		f.inodesDirty = true
+
+		return entry.Ino, entry.Gen
+	}
+
+	// The backing file was replaced: it's a new object for the clients.
+	if inode != 0 && (entry.Device != device || entry.Inode != inode) {
+		if entry.Inode != 0 {
+			entry.Gen++
+		}
+
+		entry.Device = device
+		entry.Inode = inode
+		f.inodesDirty = true
+	}
+
+	return entry.Ino, entry.Gen
+}
+
+// moveInode keeps the inode numbers of the renamed object and everything
+// below it. On exchange the two objects swap their numbers, otherwise the
+// numbers of the replaced objects are released.
+func (f *FS) moveInode(oldPath, newPath string, exchange bool) {
+	f.inodesMutex.Lock()
+	defer f.inodesMutex.Unlock()
+
+	// The map can't be added to while ranging over it: the moved paths could
+	// be visited again.
+	moved := make(map[string]*models.InodeEntry, 0)
+
+	for path, entry := range f.inodes {
+		if movedPath, ok := renamedPath(path, oldPath, newPath); ok {
+			delete(f.inodes, path)
+			moved[movedPath] = entry
+
+			continue
+		}
+
+		if movedPath, ok := renamedPath(path, newPath, oldPath); ok {
+			delete(f.inodes, path)
+
+			if exchange {
+				moved[movedPath] = entry
+			} else {
+				delete(f.usedInodes, entry.Ino)
+			}
+		}
+	}
+
+	maps.Copy(f.inodes, moved)
+
+	f.inodesDirty = true
+}
+
+// renamedPath returns the path after renaming oldPath to newPath, or false if
+// the path isn't oldPath or below it.
+func renamedPath(path, oldPath, newPath string) (string, bool) {
+	if path == oldPath {
+		return newPath, true
+	}
+
+	if rest, ok := strings.CutPrefix(path, oldPath+string(filepath.Separator)); ok {
+		return newPath + string(filepath.Separator) + rest, true
+	}
+
+	return "", false
+}
+
+// allocateInode derives the inode number from the path hash, resolving the
+// collisions with the next free number. Must be called with inodesMutex held.
+func (f *FS) allocateInode(backingPath string) uint64 {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(backingPath))
+
+	// Numbers from 2^63 are used by go-fuse for the automatic inodes.
+	ino := hash.Sum64() & math.MaxInt64
+	if ino < firstDynamicInode {
+		ino += firstDynamicInode
+	}
+
+	for {
+		if _, used := f.usedInodes[ino]; !used {
+			break
+		}
+
+		ino++
+		if ino > math.MaxInt64 {
+			ino = firstDynamicInode
+		}
+	}
+
+	f.usedInodes[ino] = struct{}{}
+
+	return ino
+}
+
+// loadInodes reads the persistent inode table.
+func (f *FS) loadInodes() error {
+	rawTable, err := os.ReadFile(f.inodeTablePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToLoadInodeTable, err)
+	}
+
+	table := make(map[string]*models.InodeEntry, 0)
+
+	err = json.Unmarshal(rawTable, &table)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToLoadInodeTable, err)
+	}
+
+	f.inodesMutex.Lock()
+	defer f.inodesMutex.Unlock()
+
+	pruned := f.pruneMissingInodes(table)
+
+	f.inodes = table
+	f.usedInodes = make(map[uint64]struct{}, len(table))
+
+	for _, entry := range table {
+		f.usedInodes[entry.Ino] = struct{}{}
+	}
+
+	f.inodesDirty = pruned > 0
+
+	f.app.Logger().WithFields(logrus.Fields{
+		"entries": len(table),
+		"pruned":  pruned,
+	}).Debug("Loaded inode table")
+
+	return nil
+}
+
+// saveInodes atomically writes the inode table to disk if it was changed.
+func (f *FS) saveInodes() error {
+	f.inodesMutex.Lock()
+
+	f.pruneLayoutInodes()
+
+	if !f.inodesDirty {
+		f.inodesMutex.Unlock()
+
+		return nil
+	}
+
+	rawTable, err := json.Marshal(f.inodes)
+	f.inodesDirty = false
+	f.inodesMutex.Unlock()
+
+	if err == nil {
+		tmpPath := f.inodeTablePath + ".tmp"
+
+		err = os.WriteFile(tmpPath, rawTable, 0o644)
+		if err == nil {
+			err = os.Rename(tmpPath, f.inodeTablePath)
+		}
+	}
+
+	if err != nil {
+		// Try again next time.
+		f.inodesMutex.Lock()
+		f.inodesDirty = true
+		f.inodesMutex.Unlock()
+
+		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToSaveInodeTable, err)
+	}
+
+	return nil
+}
+
+// pruneMissingInodes forgets the objects which are gone since the last run:
+// the files removed from the source library or the metadata store, and the
+// virtual directories which aren't shown anymore. It returns the amount of
+// removed entries.
+func (f *FS) pruneMissingInodes(table map[string]*models.InodeEntry) int {
+	layoutShown := f.layoutTemplate != nil || f.hasViews()
+	pruned := 0
+
+	for key := range table {
+		var gone bool
+
+		switch {
+		case strings.HasPrefix(key, f.layoutKey("")):
+			// The layout tree isn't built yet, the rest of the keys are
+			// checked against it on save.
+			gone = !layoutShown
+		case key == f.searchKey():
+			gone = f.searchTemplate == nil
+		default:
+			_, err := os.Lstat(key)
+			gone = errors.Is(err, os.ErrNotExist)
+		}
+
+		if gone {
+			delete(table, key)
+
+			pruned++
+		}
+	}
+
+	return pruned
+}
+
+// pruneLayoutInodes forgets the layout directories and playlists which aren't
+// in the current layout tree. Their numbers stay reserved until restart, the
+// kernel may still refer to them. Must be called with inodesMutex held.
+func (f *FS) pruneLayoutInodes() {
+	tree := f.layoutTree.Load()
+	if tree == nil {
+		return
+	}
+
+	prefix := f.layoutKey("")
+
+	for key := range f.inodes {
+		path, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+
+		if _, ok := tree.root.find(f, path); ok {
+			continue
+		}
+
+		if _, ok := tree.findFile(f, path); ok {
+			continue
+		}
+
+		delete(f.inodes, key)
+
+		f.inodesDirty = true
+	}
+}
+
+// persistInodes periodically saves the inode table until the application is
+// stopped.
+func (f *FS) persistInodes() {
+	ticker := time.NewTicker(inodeTableSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.app.Context().Done():
+			if err := f.saveInodes(); err != nil {
+				f.app.Logger().WithError(err).Error("Failed to save inode table")
+			}
+
+			return
+		case <-ticker.C:
+			if err := f.saveInodes(); err != nil {
+				f.app.Logger().WithError(err).Error("Failed to save inode table")
+			}
+		}
+	}
+}
+
+// parentInode returns the inode number of the directory containing the
+// source path, for the ".." directory entries.
+func (f *FS) parentInode(sourcePath string) uint64 {
+	parentPath := filepath.Dir(sourcePath)
+	if parentPath == filepath.Clean(f.sourceDir) {
+		return 1
+	}
+
+	ino, _ := f.inode(parentPath)
+
+	return ino
+}
+
+// nodeParentInode returns the inode number of the directory the node was
+// looked up in, for the ".." entries of the directories without a source path.
+func nodeParentInode(node *fs.Inode) uint64 {
+	_, parent := node.Parent()
+	if parent == nil {
+		return 1
+	}
+
+	return parent.StableAttr().Ino
 }
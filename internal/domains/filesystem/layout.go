@@ -0,0 +1,444 @@
+package filesystem
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/pathtemplate"
+)
+
+// layoutMaxAge is how often the layout is rebuilt for the recently added view
+// and the playlists to drop the tracks which aren't recent anymore.
+const layoutMaxAge = time.Hour
+
+// layoutTree is the virtual tree built from the library index with the
+// layout template. It's rebuilt when the index changes.
+type layoutTree struct {
+	version uint64
+	built   time.Time
+	root    *layoutDir
+}
+
+// layoutDir is the directory of the layout tree. The names are the final
+// ones, already normalized, sanitized and shortened. The directories of the
+// views are read-only, they can't hold client metadata.
+type layoutDir struct {
+	path       string
+	pathLength int
+	readOnly   bool
+	dirs       map[string]*layoutDir
+	files      map[string]*layoutFile
+	folded     map[string]string
+	names      []string
+	sourceDirs map[string]struct{}
+}
+
+// layoutFile is the track, the passed through source file or the generated
+// playlist in the layout tree.
+type layoutFile struct {
+	sourcePath string
+	isFLAC     bool
+	playlist   []byte
+}
+
+func newLayoutDir(path string, pathLength int, readOnly bool) *layoutDir {
+	return &layoutDir{
+		path:       path,
+		pathLength: pathLength,
+		readOnly:   readOnly,
+		dirs:       make(map[string]*layoutDir, 0),
+		files:      make(map[string]*layoutFile, 0),
+		folded:     make(map[string]string, 0),
+		sourceDirs: make(map[string]struct{}, 0),
+	}
+}
+
+// resolve returns the name of the entry matching the name exactly, or by the
+// folded name.
+func (d *layoutDir) resolve(f *FS, name string) (string, bool) {
+	if _, ok := d.dirs[name]; ok {
+		return name, true
+	}
+
+	if _, ok := d.files[name]; ok {
+		return name, true
+	}
+
+	name, ok := d.folded[f.foldName(name)]
+
+	return name, ok
+}
+
+// find returns the directory at the path relative to this one.
+func (d *layoutDir) find(f *FS, path string) (*layoutDir, bool) {
+	dir := d
+
+	for part := range strings.SplitSeq(path, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+
+		name, ok := dir.resolve(f, part)
+		if !ok {
+			return nil, false
+		}
+
+		dir, ok = dir.dirs[name]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return dir, true
+}
+
+// addDir returns the subdirectory with the name, creating it if needed.
+// Names differing only in case or normalization form share the directory.
+func (d *layoutDir) addDir(f *FS, component string) *layoutDir {
+	return d.addChildDir(f, component, d.readOnly)
+}
+
+// addView adds the read-only directory of the view.
+func (d *layoutDir) addView(f *FS, component string) *layoutDir {
+	return d.addChildDir(f, component, true)
+}
+
+func (d *layoutDir) addChildDir(f *FS, component string, readOnly bool) *layoutDir {
+	name := f.layoutName(component, component, d.pathLength)
+
+	if existing, ok := d.folded[f.foldName(name)]; ok {
+		if dir, ok := d.dirs[existing]; ok && dir.readOnly == readOnly {
+			return dir
+		}
+
+		// A file or a view has the name already.
+		name = shortenName(name, component, f.nameLimit(d.pathLength))
+	}
+
+	dir := newLayoutDir(filepath.Join(d.path, name), d.pathLength+nameLength(name)+1, readOnly)
+	d.dirs[name] = dir
+	d.folded[f.foldName(name)] = name
+
+	return dir
+}
+
+// addFile adds the file to the directory and returns its final name.
+// Colliding tracks are told apart by the hash suffix, other colliding files
+// are skipped.
+func (d *layoutDir) addFile(f *FS, component string, file *layoutFile) (string, bool) {
+	name := f.layoutName(component, file.sourcePath, d.pathLength)
+
+	if _, ok := d.folded[f.foldName(name)]; ok {
+		if !file.isFLAC {
+			return "", false
+		}
+
+		name = shortenName(name, file.sourcePath, f.nameLimit(d.pathLength))
+
+		if _, ok := d.folded[f.foldName(name)]; ok {
+			return "", false
+		}
+	}
+
+	d.files[name] = file
+	d.folded[f.foldName(name)] = name
+
+	return name, true
+}
+
+// finish adds the passed through files from the source directories of the
+// albums and sorts the listings.
+func (d *layoutDir) finish(f *FS) {
+	sourceDirs := make([]string, 0, len(d.sourceDirs))
+	for sourceDir := range d.sourceDirs {
+		sourceDirs = append(sourceDirs, sourceDir)
+	}
+
+	slices.Sort(sourceDirs)
+
+	for _, sourceDir := range sourceDirs {
+		entries, err := os.ReadDir(sourceDir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+
+			if strings.HasPrefix(name, ".") || isSourceDir(sourceDir, entry) ||
+				f.isHiddenSourceFile(sourceDir, entry) || strings.HasSuffix(strings.ToLower(name), ".flac") {
+				continue
+			}
+
+			d.addFile(f, name, &layoutFile{sourcePath: filepath.Join(sourceDir, name)})
+		}
+	}
+
+	d.names = make([]string, 0, len(d.dirs)+len(d.files))
+
+	for name, dir := range d.dirs {
+		dir.finish(f)
+		d.names = append(d.names, name)
+	}
+
+	for name := range d.files {
+		d.names = append(d.names, name)
+	}
+
+	slices.Sort(d.names)
+}
+
+// layoutName returns the final name of the layout tree entry. The hash key
+// keeps the shortened names the same across the rebuilds.
+func (f *FS) layoutName(component, hashKey string, dirPathLength int) string {
+	name := f.plainName(component)
+
+	if f.names.Sanitize {
+		name = sanitizeName(name, f.names.Replacement)
+	}
+
+	if limit := f.nameLimit(dirPathLength); nameLength(name) > limit {
+		name = shortenName(name, hashKey, limit)
+	}
+
+	return name
+}
+
+// currentLayout returns the layout tree for the current library index.
+func (f *FS) currentLayout() *layoutTree {
+	tracks, version := f.library.Tracks()
+
+	if tree := f.layoutTree.Load(); f.isLayoutUpToDate(tree, version) {
+		return tree
+	}
+
+	f.layoutMutex.Lock()
+	defer f.layoutMutex.Unlock()
+
+	if tree := f.layoutTree.Load(); f.isLayoutUpToDate(tree, version) {
+		return tree
+	}
+
+	tree := f.buildLayout(tracks, version)
+	f.layoutTree.Store(tree)
+
+	return tree
+}
+
+// rebuildLayout builds the layout tree again for the changes the library
+// index doesn't follow, like the covers next to the tracks.
+func (f *FS) rebuildLayout() *layoutTree {
+	tracks, version := f.library.Tracks()
+
+	f.layoutMutex.Lock()
+	defer f.layoutMutex.Unlock()
+
+	tree := f.buildLayout(tracks, version)
+	f.layoutTree.Store(tree)
+
+	return tree
+}
+
+// isLayoutUpToDate reports whether the layout tree was built from the current
+// library index. The recently added view and the playlists with the relative
+// dates also go out of date with time.
+func (f *FS) isLayoutUpToDate(tree *layoutTree, version uint64) bool {
+	if tree == nil || tree.version != version {
+		return false
+	}
+
+	return !f.views.hasRecent() && len(f.playlists) == 0 || time.Since(tree.built) < layoutMaxAge
+}
+
+// buildLayout places every track at the path rendered from the template, and
+// in the views.
+func (f *FS) buildLayout(tracks []*dto.Track, version uint64) *layoutTree {
+	started := time.Now()
+	root := newLayoutDir("", 0, false)
+	albumUniques := f.albumUniques(tracks)
+	albumAdded := f.albumAdded(tracks)
+
+	newFields := func(track *dto.Track) *trackFields {
+		identity := f.albumIdentity(track)
+
+		return &trackFields{
+			f:           f,
+			track:       track,
+			albumUnique: albumUniques[identity],
+			albumAdded:  albumAdded[identity],
+		}
+	}
+
+	// The views go first, so the template can't take their names.
+	for _, view := range f.views {
+		viewDir := root.addView(f, view.name)
+
+		for _, track := range tracks {
+			f.placeViewTrack(viewDir, view, newFields(track), started)
+		}
+	}
+
+	var playlistsDir *layoutDir
+	if len(f.playlists) > 0 {
+		playlistsDir = root.addView(f, playlistsDirName)
+	}
+
+	paths := make(map[string]string, 0)
+
+	if f.layoutTemplate != nil {
+		for _, track := range tracks {
+			if path, ok := f.placeTrack(root, f.layoutTemplate, newFields(track)); ok {
+				paths[track.SourcePath] = path
+			}
+		}
+	}
+
+	if playlistsDir != nil {
+		f.addPlaylists(playlistsDir, tracks, paths)
+	}
+
+	root.finish(f)
+
+	f.app.Logger().WithFields(logrus.Fields{
+		"tracks":   len(tracks),
+		"views":    len(f.views),
+		"duration": time.Since(started),
+	}).Debug("Built virtual layout")
+
+	return &layoutTree{version: version, built: time.Now(), root: root}
+}
+
+// placeTrack adds the track to the directory at the path rendered from the
+// template, and returns the virtual path of the track.
+func (f *FS) placeTrack(root *layoutDir, template *pathtemplate.Template, fields *trackFields) (string, bool) {
+	track := fields.track
+	components := strings.Split(template.Execute(fields), "/")
+
+	dir := root
+	for _, component := range components[:len(components)-1] {
+		dir = dir.addDir(f, cleanComponent(component, f.names.Replacement))
+	}
+
+	name := cleanComponent(components[len(components)-1], f.names.Replacement) + ".m4a"
+
+	added, ok := dir.addFile(f, name, &layoutFile{sourcePath: track.SourcePath, isFLAC: true})
+	if !ok {
+		f.app.Logger().WithFields(logrus.Fields{
+			"source file":  track.SourcePath,
+			"virtual path": filepath.Join(dir.path, name),
+		}).Warn("Track path collides with another one and is hidden")
+
+		return "", false
+	}
+
+	// Singles come from anywhere, so their directories have nothing to
+	// share with the album.
+	if track.Tags.Get("ALBUM") != "" {
+		dir.sourceDirs[filepath.Dir(track.SourcePath)] = struct{}{}
+	}
+
+	return filepath.Join(dir.path, added), true
+}
+
+// albumIdentity tells apart the albums with the same artist and title by the
+// MusicBrainz release ID, or by the year if the tracks aren't tagged with it.
+// The source directories don't matter: the album may be split into the disc
+// directories.
+func (f *FS) albumIdentity(track *dto.Track) string {
+	if releaseID := track.Tags.Get("MUSICBRAINZ_ALBUMID"); releaseID != "" {
+		return f.albumName(track) + "\x00" + releaseID
+	}
+
+	return f.albumName(track) + "\x00" + trackYear(track)
+}
+
+func (f *FS) albumName(track *dto.Track) string {
+	fields := &trackFields{f: f, track: track}
+
+	return fields.rawField("albumartist") + "\x00" + fields.rawField("album")
+}
+
+// albumUniques returns the %aunique{} values of the albums sharing the artist
+// and title with the other ones: the year if it tells them apart, or the
+// sequence number otherwise.
+func (f *FS) albumUniques(tracks []*dto.Track) map[string]string {
+	albums := make(map[string][]string, 0)
+	years := make(map[string]string, 0)
+
+	for _, track := range tracks {
+		if track.Tags.Get("ALBUM") == "" {
+			continue
+		}
+
+		identity := f.albumIdentity(track)
+		if _, ok := years[identity]; ok {
+			continue
+		}
+
+		years[identity] = trackYear(track)
+
+		name := f.albumName(track)
+		albums[name] = append(albums[name], identity)
+	}
+
+	uniques := make(map[string]string, 0)
+
+	for _, identities := range albums {
+		if len(identities) < 2 {
+			continue
+		}
+
+		seen := make(map[string]struct{}, len(identities))
+		distinctYears := true
+
+		for _, identity := range identities {
+			year := years[identity]
+			if _, ok := seen[year]; ok || year == "" {
+				distinctYears = false
+			}
+
+			seen[year] = struct{}{}
+		}
+
+		for i, identity := range identities {
+			if distinctYears {
+				uniques[identity] = fmt.Sprintf(" [%s]", years[identity])
+			} else {
+				uniques[identity] = fmt.Sprintf(" [%d]", i+1)
+			}
+		}
+	}
+
+	return uniques
+}
+
+// albumAdded returns the time the albums were added at: the time the latest
+// track of the album was added.
+func (f *FS) albumAdded(tracks []*dto.Track) map[string]time.Time {
+	added := make(map[string]time.Time, 0)
+
+	for _, track := range tracks {
+		identity := f.albumIdentity(track)
+		if track.Added.After(added[identity]) {
+			added[identity] = track.Added
+		}
+	}
+
+	return added
+}
+
+// cleanComponent makes a usable name of the rendered path component.
+func cleanComponent(component, replacement string) string {
+	component = strings.TrimSpace(component)
+	if component == "" || component == "." || component == ".." {
+		return replacement
+	}
+
+	return component
+}
@@ -0,0 +1,301 @@
+package filesystem
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// LayoutDir is the directory of the virtual layout built from the track
+// tags. Like the mirrored directories, it can hold client metadata, unless
+// it belongs to a view.
+type LayoutDir struct {
+	fs.Inode
+
+	f    *FS
+	path string
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*LayoutDir)(nil))
+	_ = (fs.NodeLookuper)((*LayoutDir)(nil))
+	_ = (fs.NodeReaddirer)((*LayoutDir)(nil))
+	_ = (fs.NodeCreater)((*LayoutDir)(nil))
+	_ = (fs.NodeMkdirer)((*LayoutDir)(nil))
+	_ = (fs.NodeRmdirer)((*LayoutDir)(nil))
+	_ = (fs.NodeUnlinker)((*LayoutDir)(nil))
+	_ = (fs.NodeRenamer)((*LayoutDir)(nil))
+	_ = (fs.NodeGetxattrer)((*LayoutDir)(nil))
+	_ = (fs.NodeSetxattrer)((*LayoutDir)(nil))
+	_ = (fs.NodeRemovexattrer)((*LayoutDir)(nil))
+	_ = (fs.NodeListxattrer)((*LayoutDir)(nil))
+	_ = (fs.NodeStatfser)((*LayoutDir)(nil))
+)
+
+func (d *LayoutDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	tree := d.f.currentLayout()
+
+	dir, ok := tree.root.find(d.f, d.path)
+	if !ok {
+		return syscall.ENOENT
+	}
+
+	d.f.fillLayoutDirAttr(tree, dir, d.StableAttr().Ino, &out.Attr)
+
+	return 0
+}
+
+func (d *LayoutDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	return d.f.lookupLayout(ctx, &d.Inode, d.path, name, out)
+}
+
+func (d *LayoutDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	dirEntries := []fuse.DirEntry{
+		{Name: ".", Mode: d.f.dirMode(0o755), Ino: d.StableAttr().Ino},
+		{Name: "..", Mode: d.f.dirMode(0o755), Ino: nodeParentInode(&d.Inode)},
+	}
+
+	return fs.NewListDirStream(append(dirEntries, d.f.layoutDirEntries(d.path)...)), 0
+}
+
+func (d *LayoutDir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	return d.f.getXattr(d.f.layoutKey(d.path), attr, dest)
+}
+
+func (d *LayoutDir) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	return d.f.setXattr(d.f.layoutKey(d.path), attr, data, flags)
+}
+
+func (d *LayoutDir) Removexattr(ctx context.Context, attr string) syscall.Errno {
+	return d.f.removeXattr(d.f.layoutKey(d.path), attr)
+}
+
+func (d *LayoutDir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	return d.f.listXattrs(d.f.layoutKey(d.path), dest)
+}
+
+func (d *LayoutDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.f.statfs(out)
+}
+
+func (f *FS) NewLayoutDirectory(path string) *LayoutDir {
+	return &LayoutDir{
+		f:    f,
+		path: path,
+	}
+}
+
+// Only client metadata can be changed, the library content is read-only.
+
+func (d *LayoutDir) metadataChildPath(name string) (string, bool) {
+	return d.f.layoutMetadataChildPath(d.path, name)
+}
+
+func (d *LayoutDir) Create(
+	ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut,
+) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return nil, nil, 0, syscall.EPERM
+	}
+
+	return d.f.createMetadata(ctx, &d.Inode, metaPath, flags, mode, out)
+}
+
+func (d *LayoutDir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return nil, syscall.EPERM
+	}
+
+	return d.f.mkdirMetadata(ctx, &d.Inode, metaPath, mode, out)
+}
+
+func (d *LayoutDir) Rmdir(ctx context.Context, name string) syscall.Errno {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return d.f.removeMetadata(metaPath, true)
+}
+
+func (d *LayoutDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return d.f.removeMetadata(metaPath, false)
+}
+
+func (d *LayoutDir) Rename(
+	ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32,
+) syscall.Errno {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return d.f.renameMetadata(metaPath, newParent, newName, flags)
+}
+
+// hasViews reports whether the root has the view or the playlists
+// directories.
+func (f *FS) hasViews() bool {
+	return len(f.views) > 0 || len(f.playlists) > 0
+}
+
+// isView reports whether the name is the view or the playlists directory in
+// the root of the mirrored tree.
+func (f *FS) isView(name string) bool {
+	if !f.hasViews() {
+		return false
+	}
+
+	_, ok := f.currentLayout().root.resolve(f, name)
+
+	return ok
+}
+
+// layoutKey is the key of the layout directory in the inode table and the
+// extended attributes store. It can't be mixed up with the source paths.
+func (f *FS) layoutKey(path string) string {
+	return "layout:/" + path
+}
+
+// lookupLayout finds the entry of the layout directory: a subdirectory, a
+// track, a passed through file or client metadata.
+func (f *FS) lookupLayout(
+	ctx context.Context, parent *fs.Inode, dirPath, name string, out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	tree := f.currentLayout()
+
+	dir, ok := tree.root.find(f, dirPath)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	if existing, ok := dir.resolve(f, name); ok {
+		if child, ok := dir.dirs[existing]; ok {
+			ch := parent.NewInode(
+				ctx,
+				f.NewLayoutDirectory(child.path),
+				f.stableAttr(f.layoutKey(child.path), fuse.S_IFDIR),
+			)
+			f.fillLayoutDirAttr(tree, child, ch.StableAttr().Ino, &out.Attr)
+
+			return ch, 0
+		}
+
+		return f.lookupLayoutFile(ctx, parent, tree, dir, existing, out)
+	}
+
+	if metaPath, ok := f.layoutMetadataChildPath(dirPath, name); ok {
+		return f.lookupMetadata(ctx, parent, metaPath, out)
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// lookupLayoutFile creates the node for the file of the layout directory.
+// The tracks and the passed through files get the same nodes as the source
+// files get in the mirrored tree.
+func (f *FS) lookupLayoutFile(
+	ctx context.Context, parent *fs.Inode, tree *layoutTree, dir *layoutDir, name string, out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	file := dir.files[name]
+
+	if file.playlist != nil {
+		path := filepath.Join(dir.path, name)
+		ch := parent.NewInode(ctx, f.NewPlaylistFile(path), f.stableAttr(f.layoutKey(path), fuse.S_IFREG))
+		f.fillPlaylistAttr(tree, file, ch.StableAttr().Ino, &out.Attr)
+
+		return ch, 0
+	}
+
+	return f.lookupSource(ctx, parent, filepath.Dir(file.sourcePath), &nameEntry{
+		sourceName:  filepath.Base(file.sourcePath),
+		virtualName: name,
+		isFLAC:      file.isFLAC,
+	}, out)
+}
+
+// layoutDirEntries lists the layout directory and its client metadata.
+func (f *FS) layoutDirEntries(dirPath string) []fuse.DirEntry {
+	return append(f.layoutEntries(dirPath), f.metadataDirEntries(
+		filepath.Join(f.metadataDir, dirPath),
+		func(name string) bool {
+			_, ok := f.layoutMetadataChildPath(dirPath, name)
+
+			return ok
+		},
+	)...)
+}
+
+// layoutEntries lists the layout directory without the client metadata.
+func (f *FS) layoutEntries(dirPath string) []fuse.DirEntry {
+	dir, ok := f.currentLayout().root.find(f, dirPath)
+	if !ok {
+		return nil
+	}
+
+	return f.listLayoutDir(dir)
+}
+
+func (f *FS) listLayoutDir(dir *layoutDir) []fuse.DirEntry {
+	dirEntries := make([]fuse.DirEntry, 0, len(dir.names))
+
+	for _, name := range dir.names {
+		if child, ok := dir.dirs[name]; ok {
+			ino, _ := f.inode(f.layoutKey(child.path))
+			dirEntries = append(dirEntries, fuse.DirEntry{Name: name, Mode: f.dirMode(0o755), Ino: ino})
+
+			continue
+		}
+
+		key := dir.files[name].sourcePath
+		if dir.files[name].playlist != nil {
+			key = f.layoutKey(filepath.Join(dir.path, name))
+		}
+
+		ino, _ := f.inode(key)
+		dirEntries = append(dirEntries, fuse.DirEntry{Name: name, Mode: f.fileMode(0o444), Ino: ino})
+	}
+
+	return dirEntries
+}
+
+// layoutMetadataChildPath returns the path of the client metadata in the
+// layout directory. The metadata store mirrors the layout tree.
+func (f *FS) layoutMetadataChildPath(dirPath, name string) (string, bool) {
+	metaPath := filepath.Join(f.metadataDir, dirPath, name)
+
+	if !f.metadataRules.match(name) {
+		return metaPath, false
+	}
+
+	dir, ok := f.currentLayout().root.find(f, dirPath)
+	if !ok || dir.readOnly {
+		return metaPath, false
+	}
+
+	_, exists := dir.resolve(f, name)
+
+	return metaPath, !exists
+}
+
+func (f *FS) fillLayoutDirAttr(tree *layoutTree, dir *layoutDir, ino uint64, out *fuse.Attr) {
+	out.Mode = f.dirMode(0o755)
+	out.Nlink = 2 + uint32(len(dir.dirs))
+	out.Ino = ino
+	out.Size = 4096
+	out.Mtime = uint64(tree.built.Unix())
+	out.Atime = out.Mtime
+	out.Ctime = out.Mtime
+	out.Blocks = 1
+	out.Blksize = 512
+}
@@ -0,0 +1,70 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// lookupSource creates the node for the source directory entry: a virtual
+// track for FLACs, a directory, or a passed through source file.
+func (f *FS) lookupSource(
+	ctx context.Context, parent *fs.Inode, sourceDir string, entry *nameEntry, out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	fullPath := filepath.Join(sourceDir, entry.sourceName)
+
+	if entry.isFLAC {
+		ch := parent.NewInode(
+			ctx,
+			f.NewMusicFile(fullPath, entry.virtualName),
+			f.stableAttr(fullPath, fuse.S_IFREG),
+		)
+
+		out.Mode = f.fileMode(0o444)
+		out.Nlink = 1
+		out.Ino = ch.StableAttr().Ino
+
+		if stat, err := f.cacher.GetStat(fullPath); err == nil {
+			out.Size = uint64(stat.Size)
+			out.Mtime = uint64(stat.ModTime.Unix())
+		} else {
+			out.Size = 0
+		}
+
+		out.Atime = out.Mtime
+		out.Ctime = out.Mtime
+		out.Blocks = (out.Size + 511) / 512
+
+		return ch, 0
+	}
+
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		return nil, syscall.ENOENT
+	}
+
+	if info.IsDir() {
+		ch := parent.NewInode(ctx, f.NewMusicDirectory(fullPath), f.stableAttr(fullPath, fuse.S_IFDIR))
+
+		out.Mode = f.dirMode(0o755)
+		out.Nlink = 2 // Minimum . and ..
+		out.Ino = ch.StableAttr().Ino
+		out.Size = 4096
+		out.Mtime = uint64(info.ModTime().Unix())
+		out.Atime = out.Mtime
+		out.Ctime = out.Mtime
+		out.Blocks = 1
+
+		return ch, 0
+	}
+
+	// Regular file (non-FLAC)
+	ch := parent.NewInode(ctx, f.NewSourceFile(fullPath), f.stableAttr(fullPath, fuse.S_IFREG))
+	f.fillSourceFileAttr(info, ch.StableAttr().Ino, &out.Attr)
+
+	return ch, 0
+}
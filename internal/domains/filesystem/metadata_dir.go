@@ -0,0 +1,138 @@
+package filesystem
+
+import (
+	"context"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// MetadataDir is a directory created by a client, like "Album Artwork" of
+// iTunes. It lives in the metadata store only, and everything inside it is
+// client metadata.
+type MetadataDir struct {
+	fs.Inode
+
+	f    *FS
+	path string
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*MetadataDir)(nil))
+	_ = (fs.NodeGetxattrer)((*MetadataDir)(nil))
+	_ = (fs.NodeSetxattrer)((*MetadataDir)(nil))
+	_ = (fs.NodeRemovexattrer)((*MetadataDir)(nil))
+	_ = (fs.NodeListxattrer)((*MetadataDir)(nil))
+	_ = (fs.NodeStatfser)((*MetadataDir)(nil))
+	_ = (fs.NodeSetattrer)((*MetadataDir)(nil))
+	_ = (fs.NodeLookuper)((*MetadataDir)(nil))
+	_ = (fs.NodeReaddirer)((*MetadataDir)(nil))
+	_ = (fs.NodeCreater)((*MetadataDir)(nil))
+	_ = (fs.NodeMkdirer)((*MetadataDir)(nil))
+	_ = (fs.NodeRmdirer)((*MetadataDir)(nil))
+	_ = (fs.NodeUnlinker)((*MetadataDir)(nil))
+	_ = (fs.NodeRenamer)((*MetadataDir)(nil))
+)
+
+func (m *MetadataDir) currentPath() string {
+	return m.f.metadataNodePath(&m.Inode, m.path)
+}
+
+func (m *MetadataDir) metadataChildPath(name string) (string, bool) {
+	return filepath.Join(m.currentPath(), name), true
+}
+
+func (m *MetadataDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	return m.f.metadataAttr(m.currentPath(), m.StableAttr().Ino, &out.Attr)
+}
+
+func (m *MetadataDir) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	errno := m.f.setMetadataAttr(m.currentPath(), fh, in)
+	if errno != 0 {
+		return errno
+	}
+
+	return m.Getattr(ctx, fh, out)
+}
+
+func (m *MetadataDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	metaPath, _ := m.metadataChildPath(name)
+
+	return m.f.lookupMetadata(ctx, &m.Inode, metaPath, out)
+}
+
+func (m *MetadataDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	dirEntries := []fuse.DirEntry{
+		{Name: ".", Mode: m.f.dirMode(0o755), Ino: m.StableAttr().Ino},
+		{Name: "..", Mode: m.f.dirMode(0o755), Ino: nodeParentInode(&m.Inode)},
+	}
+
+	dirEntries = append(dirEntries, m.f.metadataDirEntries(m.currentPath(), func(string) bool {
+		return true
+	})...)
+
+	return fs.NewListDirStream(dirEntries), 0
+}
+
+func (m *MetadataDir) Create(
+	ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut,
+) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	metaPath, _ := m.metadataChildPath(name)
+
+	return m.f.createMetadata(ctx, &m.Inode, metaPath, flags, mode, out)
+}
+
+func (m *MetadataDir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	metaPath, _ := m.metadataChildPath(name)
+
+	return m.f.mkdirMetadata(ctx, &m.Inode, metaPath, mode, out)
+}
+
+func (m *MetadataDir) Rmdir(ctx context.Context, name string) syscall.Errno {
+	metaPath, _ := m.metadataChildPath(name)
+
+	return m.f.removeMetadata(metaPath, true)
+}
+
+func (m *MetadataDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	metaPath, _ := m.metadataChildPath(name)
+
+	return m.f.removeMetadata(metaPath, false)
+}
+
+func (m *MetadataDir) Rename(
+	ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32,
+) syscall.Errno {
+	metaPath, _ := m.metadataChildPath(name)
+
+	return m.f.renameMetadata(metaPath, newParent, newName, flags)
+}
+
+func (m *MetadataDir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	return m.f.getXattr(m.currentPath(), attr, dest)
+}
+
+func (m *MetadataDir) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	return m.f.setXattr(m.currentPath(), attr, data, flags)
+}
+
+func (m *MetadataDir) Removexattr(ctx context.Context, attr string) syscall.Errno {
+	return m.f.removeXattr(m.currentPath(), attr)
+}
+
+func (m *MetadataDir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	return m.f.listXattrs(m.currentPath(), dest)
+}
+
+func (m *MetadataDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return m.f.statfs(out)
+}
+
+func (f *FS) NewMetadataDirectory(path string) *MetadataDir {
+	return &MetadataDir{
+		f:    f,
+		path: path,
+	}
+}
@@ -0,0 +1,68 @@
+package filesystem
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+)
+
+// metadataRules classify the names of client metadata files.
+type metadataRules struct {
+	globs   []string
+	regexes []*regexp.Regexp
+}
+
+func newMetadataRules(config configuration.Metadata) *metadataRules {
+	rules := &metadataRules{
+		globs:   config.Rules(),
+		regexes: make([]*regexp.Regexp, 0, len(config.Regexes)),
+	}
+
+	// Regexes are validated with the configuration.
+	for _, expression := range config.Regexes {
+		rules.regexes = append(rules.regexes, regexp.MustCompile(expression))
+	}
+
+	return rules
+}
+
+func (m *metadataRules) match(name string) bool {
+	lowerName := strings.ToLower(name)
+
+	for _, glob := range m.globs {
+		if matched, _ := path.Match(glob, lowerName); matched {
+			return true
+		}
+	}
+
+	for _, regex := range m.regexes {
+		if regex.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isClientMetadata returns true if the name in the source directory belongs
+// to a client metadata file. Library content always wins: a name of a source
+// file or directory, or of a transcoded FLAC, is never a metadata one.
+func (f *FS) isClientMetadata(sourceDir, name string) bool {
+	if !f.metadataRules.match(name) {
+		return false
+	}
+
+	if _, err := os.Lstat(filepath.Join(sourceDir, name)); err == nil {
+		return false
+	}
+
+	if _, ok := f.resolveName(sourceDir, name); ok {
+		return false
+	}
+
+	return true
+}
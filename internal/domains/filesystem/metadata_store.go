@@ -0,0 +1,268 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"golang.org/x/sys/unix"
+)
+
+// metadataParent is a directory node which can hold client metadata.
+type metadataParent interface {
+	// metadataChildPath returns the path of the child in the metadata store
+	// and whether the name can be used for client metadata in the directory.
+	metadataChildPath(name string) (string, bool)
+}
+
+// metadataPath returns the path of the client metadata file in the metadata
+// store. The store mirrors the virtual directory structure, so every
+// directory has its own metadata files.
+func (f *FS) metadataPath(sourceDir, name string) string {
+	relPath, err := filepath.Rel(f.sourceDir, sourceDir)
+	if err != nil {
+		relPath = "."
+	}
+
+	return filepath.Join(f.metadataDir, relPath, name)
+}
+
+// metadataNodePath returns the current path of the metadata node in the
+// store. It's taken from the node's place in the tree, so it follows the
+// renames of the node and its parents.
+func (f *FS) metadataNodePath(node *fs.Inode, fallback string) string {
+	name, parent := node.Parent()
+	if parent == nil {
+		return fallback
+	}
+
+	mp, ok := parent.Operations().(metadataParent)
+	if !ok {
+		return fallback
+	}
+
+	metaPath, _ := mp.metadataChildPath(name)
+
+	return metaPath
+}
+
+// metadataAttr fills the attributes of the object in the metadata store.
+func (f *FS) metadataAttr(metaPath string, ino uint64, out *fuse.Attr) syscall.Errno {
+	var st syscall.Stat_t
+
+	err := syscall.Lstat(metaPath, &st)
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+
+	out.FromStat(&st)
+	out.Ino = ino
+
+	// The store holds only regular files and directories.
+	if st.Mode&syscall.S_IFMT == syscall.S_IFDIR {
+		out.Mode = f.dirMode(st.Mode & 0o777)
+	} else {
+		out.Mode = f.fileMode(st.Mode & 0o777)
+	}
+
+	f.applyOwnership(out)
+
+	return 0
+}
+
+// setMetadataAttr applies the attribute changes to the object in the
+// metadata store.
+func (f *FS) setMetadataAttr(metaPath string, fh fs.FileHandle, in *fuse.SetAttrIn) syscall.Errno {
+	if size, ok := in.GetSize(); ok {
+		var err error
+
+		if handle, ok := fh.(*File); ok {
+			err = handle.file.Truncate(int64(size))
+		} else {
+			err = os.Truncate(metaPath, int64(size))
+		}
+
+		if err != nil {
+			return fs.ToErrno(err)
+		}
+	}
+
+	if mode, ok := in.GetMode(); ok {
+		err := os.Chmod(metaPath, os.FileMode(mode&0o777))
+		if err != nil {
+			return fs.ToErrno(err)
+		}
+	}
+
+	atime, atimeOK := in.GetATime()
+	mtime, mtimeOK := in.GetMTime()
+
+	// Zero times are left unchanged.
+	if atimeOK || mtimeOK {
+		err := os.Chtimes(metaPath, atime, mtime)
+		if err != nil {
+			return fs.ToErrno(err)
+		}
+	}
+
+	return 0
+}
+
+// lookupMetadata finds the client metadata file or directory in the store.
+func (f *FS) lookupMetadata(
+	ctx context.Context, parent *fs.Inode, metaPath string, out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	info, err := os.Lstat(metaPath)
+	if err != nil {
+		return nil, syscall.ENOENT
+	}
+
+	var ch *fs.Inode
+
+	if info.IsDir() {
+		ch = parent.NewInode(ctx, f.NewMetadataDirectory(metaPath), f.stableAttr(metaPath, fuse.S_IFDIR))
+	} else {
+		ch = parent.NewInode(ctx, f.NewMusicAppMetadataFile(metaPath), f.stableAttr(metaPath, fuse.S_IFREG))
+	}
+
+	return ch, f.metadataAttr(metaPath, ch.StableAttr().Ino, &out.Attr)
+}
+
+// createMetadata creates the client metadata file in the store.
+func (f *FS) createMetadata(
+	ctx context.Context, parent *fs.Inode, metaPath string, flags, mode uint32, out *fuse.EntryOut,
+) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	err := os.MkdirAll(filepath.Dir(metaPath), 0o755)
+	if err != nil {
+		return nil, nil, 0, syscall.EIO
+	}
+
+	file, err := os.OpenFile(metaPath, int(flags)&^os.O_APPEND|os.O_CREATE, os.FileMode(mode&0o777))
+	if err != nil {
+		return nil, nil, 0, fs.ToErrno(err)
+	}
+
+	ch := parent.NewInode(
+		ctx,
+		f.NewMusicAppMetadataFile(metaPath),
+		f.stableAttr(metaPath, fuse.S_IFREG),
+	)
+
+	errno := f.metadataAttr(metaPath, ch.StableAttr().Ino, &out.Attr)
+	if errno != 0 {
+		file.Close()
+
+		return nil, nil, 0, errno
+	}
+
+	return ch, &File{file: file}, fuse.FOPEN_DIRECT_IO, 0
+}
+
+// mkdirMetadata creates the client metadata directory in the store.
+func (f *FS) mkdirMetadata(
+	ctx context.Context, parent *fs.Inode, metaPath string, mode uint32, out *fuse.EntryOut,
+) (*fs.Inode, syscall.Errno) {
+	err := os.MkdirAll(filepath.Dir(metaPath), 0o755)
+	if err != nil {
+		return nil, syscall.EIO
+	}
+
+	err = os.Mkdir(metaPath, os.FileMode(mode&0o777))
+	if err != nil {
+		return nil, fs.ToErrno(err)
+	}
+
+	ch := parent.NewInode(
+		ctx,
+		f.NewMetadataDirectory(metaPath),
+		f.stableAttr(metaPath, fuse.S_IFDIR),
+	)
+
+	return ch, f.metadataAttr(metaPath, ch.StableAttr().Ino, &out.Attr)
+}
+
+// renameMetadata moves the client metadata file or directory in the store.
+// It can't be moved out of the metadata area or over library content.
+func (f *FS) renameMetadata(metaPath string, newParent fs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	mp, ok := newParent.(metadataParent)
+	if !ok {
+		return syscall.EXDEV
+	}
+
+	newMetaPath, ok := mp.metadataChildPath(newName)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	err := os.MkdirAll(filepath.Dir(newMetaPath), 0o755)
+	if err != nil {
+		return syscall.EIO
+	}
+
+	err = unix.Renameat2(unix.AT_FDCWD, metaPath, unix.AT_FDCWD, newMetaPath, uint(flags))
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+
+	exchange := flags&unix.RENAME_EXCHANGE != 0
+
+	f.moveInode(metaPath, newMetaPath, exchange)
+	f.moveXattrs(metaPath, newMetaPath, exchange)
+
+	return 0
+}
+
+// removeMetadata removes the client metadata file or empty directory from
+// the store.
+func (f *FS) removeMetadata(metaPath string, dir bool) syscall.Errno {
+	var err error
+
+	if dir {
+		err = unix.Rmdir(metaPath)
+	} else {
+		err = unix.Unlink(metaPath)
+	}
+
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+
+	f.dropXattrs(metaPath)
+
+	return 0
+}
+
+// metadataDirEntries returns the client metadata stored in the directory,
+// skipping the names shadowed by the library content.
+func (f *FS) metadataDirEntries(metaDir string, allowed func(name string) bool) []fuse.DirEntry {
+	entries, err := os.ReadDir(metaDir)
+	if err != nil {
+		return nil
+	}
+
+	dirEntries := make([]fuse.DirEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if !allowed(entry.Name()) {
+			continue
+		}
+
+		mode := f.fileMode(0o644)
+		if entry.IsDir() {
+			mode = f.dirMode(0o755)
+		}
+
+		ino, _ := f.inode(filepath.Join(metaDir, entry.Name()))
+
+		dirEntries = append(dirEntries, fuse.DirEntry{
+			Name: entry.Name(),
+			Mode: mode,
+			Ino:  ino,
+		})
+	}
+
+	return dirEntries
+}
@@ -0,0 +1,11 @@
+package models
+
+// InodeEntry is representing the inode number given to a filesystem object.
+// Device and Inode identify the backing file: if it's replaced, the
+// generation number is increased, so NFS clients won't mix them up.
+type InodeEntry struct {
+	Ino    uint64 `json:"ino"`
+	Gen    uint64 `json:"gen"`
+	Device uint64 `json:"device,omitempty"`
+	Inode  uint64 `json:"inode,omitempty"`
+}
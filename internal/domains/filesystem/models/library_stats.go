@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LibraryStats is representing the size of the virtual library, as reported
+// to the clients by statfs.
+type LibraryStats struct {
+	Size    uint64
+	Files   uint64
+	Updated time.Time
+}
@@ -0,0 +1,8 @@
+package models
+
+// XattrRecord is representing the extended attributes set by the clients on
+// a filesystem object. Key is the path of the object's backing file.
+type XattrRecord struct {
+	Key   string            `json:"key"`
+	Attrs map[string][]byte `json:"attrs"`
+}
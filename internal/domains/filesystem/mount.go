@@ -15,24 +15,33 @@ func (f *FS) mount() {
 	// Populate mount options
 	opts := &fs.Options{
 		MountOptions: fuse.MountOptions{
-			Name:          "faketunes",
-			FsName:        "faketunes",
+			Name:          mountName,
+			FsName:        f.mountConfig.FSName,
 			DisableXAttrs: false, // Enable xattr support for macOS
 			Debug:         false,
-			// AllowOther:    true,
+			AllowOther:    f.mountConfig.AllowOther,
+			MaxReadAhead:  f.mountConfig.MaxReadahead,
 			Options: []string{
 				"default_permissions",
-				"fsname=flac2alac",
 				"nosuid",
 				"nodev",
 				"noexec",
-				"ro",
 			},
 		},
+		EntryTimeout:    f.mountConfig.EntryTimeout,
+		AttrTimeout:     f.mountConfig.AttrTimeout,
 		NullPermissions: false,
 		Logger:          log.New(os.Stdout, "FUSE: ", log.LstdFlags),
 	}
 
+	if f.mountConfig.UID != nil {
+		opts.UID = *f.mountConfig.UID
+	}
+
+	if f.mountConfig.GID != nil {
+		opts.GID = *f.mountConfig.GID
+	}
+
 	// Redirect FUSE logs to logrus
 	log.SetOutput(f.app.Logger().WithField("fuse debug logs", true).WriterLevel(logrus.DebugLevel))
 
@@ -43,6 +52,9 @@ func (f *FS) mount() {
 	}
 	defer server.Unmount()
 
+	f.root.Store(rootDir)
+	defer f.root.Store(nil)
+
 	<-f.app.Context().Done()
 	f.app.Logger().Debug("Application context cancelled, unmounting FUSE server...")
 }
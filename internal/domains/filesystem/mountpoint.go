@@ -0,0 +1,244 @@
+package filesystem
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// mountName is the FUSE subtype of the faketunes mounts.
+	mountName         = "faketunes"
+	mountInfoPath     = "/proc/self/mountinfo"
+	unmountAttempts   = 5
+	unmountRetryDelay = time.Second
+)
+
+// mountInfo is the mount from /proc/self/mountinfo.
+type mountInfo struct {
+	mountPoint string
+	fsType     string
+	source     string
+}
+
+// isFaketunes reports whether the filesystem was mounted by faketunes: go-fuse
+// reports the mount name as the FUSE subtype.
+func (m *mountInfo) isFaketunes() bool {
+	return m.fsType == "fuse."+mountName
+}
+
+// prepareMountpoint makes sure nothing is mounted at the destination, and
+// that the destination is an empty directory. Filesystems left by the
+// previous runs are unmounted, but real files are never removed.
+func (f *FS) prepareMountpoint() error {
+	mountPoint, err := filepath.Abs(f.destinationDir)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToCleanupDestination, err)
+	}
+
+	// mountinfo lists the resolved paths. Only the parent is resolved: the
+	// stale mountpoint itself can't be accessed.
+	if parentDir, err := filepath.EvalSymlinks(filepath.Dir(mountPoint)); err == nil {
+		mountPoint = filepath.Join(parentDir, filepath.Base(mountPoint))
+	}
+
+	mount, err := findMount(mountPoint)
+	if err != nil {
+		return err
+	}
+
+	if mount != nil {
+		err = f.unmountStale(mount)
+		if err != nil {
+			return err
+		}
+	}
+
+	entries, err := os.ReadDir(mountPoint)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToCleanupDestination, err)
+	}
+
+	if len(entries) > 0 {
+		return fmt.Errorf(
+			"%w: %w (%s has %d entries, move them away or choose another destination)",
+			ErrFilesystem, ErrDestinationNotEmpty, mountPoint, len(entries),
+		)
+	}
+
+	return nil
+}
+
+// unmountStale lazily unmounts the filesystem left at the mountpoint by the
+// dead faketunes process. Anything else, including the running faketunes, is
+// mounted there on purpose.
+func (f *FS) unmountStale(mount *mountInfo) error {
+	if !mount.isFaketunes() {
+		return fmt.Errorf(
+			"%w: %w (foreign filesystem %s is mounted at %s as %s)",
+			ErrFilesystem, ErrForeignMount, mount.source, mount.mountPoint, mount.fsType,
+		)
+	}
+
+	// The mount of the dead process doesn't respond anymore.
+	if _, err := os.Stat(mount.mountPoint); !errors.Is(err, syscall.ENOTCONN) {
+		return fmt.Errorf(
+			"%w: %w (another faketunes is running at %s)",
+			ErrFilesystem, ErrForeignMount, mount.mountPoint,
+		)
+	}
+
+	logger := f.app.Logger().WithFields(logrus.Fields{
+		"path":   mount.mountPoint,
+		"source": mount.source,
+	})
+
+	logger.Warn("Found stale filesystem at the destination mountpoint, unmounting it")
+
+	var lastErr error
+
+	for attempt := 1; attempt <= unmountAttempts; attempt++ {
+		lastErr = unmountLazy(mount.mountPoint)
+
+		stillMounted, err := findMount(mount.mountPoint)
+		if err != nil {
+			return err
+		}
+
+		if stillMounted == nil {
+			logger.Info("Unmounted filesystem at the destination mountpoint")
+
+			return nil
+		}
+
+		logger.WithError(lastErr).WithField("attempt", attempt).Debug("Filesystem is still mounted")
+		time.Sleep(unmountRetryDelay)
+	}
+
+	return fmt.Errorf(
+		"%w: %w (%s is still mounted after %d attempts, last error: %w)",
+		ErrFilesystem, ErrFailedToUnmountStale, mount.mountPoint, unmountAttempts, lastErr,
+	)
+}
+
+// unmountLazy detaches the filesystem. Without the privileges for umount2
+// the fusermount3 helper is used.
+func unmountLazy(mountPoint string) error {
+	err := unix.Unmount(mountPoint, unix.MNT_DETACH)
+	if err == nil || !errors.Is(err, syscall.EPERM) {
+		return err
+	}
+
+	output, err := exec.Command("fusermount3", "-u", "-z", mountPoint).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("fusermount3: %w (%s)", err, strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// findMount returns the topmost mount at the mountpoint, or nil if nothing
+// is mounted there.
+func findMount(mountPoint string) (*mountInfo, error) {
+	file, err := os.Open(mountInfoPath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToReadMountInfo, err)
+	}
+	defer file.Close()
+
+	mounts, err := parseMountInfo(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToReadMountInfo, err)
+	}
+
+	var found *mountInfo
+
+	// Later mounts hide the earlier ones at the same place.
+	for i := range mounts {
+		if mounts[i].mountPoint == mountPoint {
+			found = &mounts[i]
+		}
+	}
+
+	return found, nil
+}
+
+// parseMountInfo reads the mounts in the proc(5) mountinfo format:
+// "36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw".
+func parseMountInfo(r io.Reader) ([]mountInfo, error) {
+	var mounts []mountInfo
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		separator := -1
+
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+
+				break
+			}
+		}
+
+		if len(fields) < 5 || separator < 0 || separator+2 >= len(fields) {
+			return nil, fmt.Errorf("malformed mountinfo line %q", scanner.Text())
+		}
+
+		mounts = append(mounts, mountInfo{
+			mountPoint: unescapeMountInfo(fields[4]),
+			fsType:     fields[separator+1],
+			source:     unescapeMountInfo(fields[separator+2]),
+		})
+	}
+
+	return mounts, scanner.Err()
+}
+
+// unescapeMountInfo decodes the octal escapes the kernel uses for spaces,
+// tabs, newlines and backslashes.
+func unescapeMountInfo(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+
+	var builder strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) && isOctal(value[i+1:i+4]) {
+			builder.WriteByte((value[i+1]-'0')<<6 | (value[i+2]-'0')<<3 | (value[i+3] - '0'))
+			i += 3
+
+			continue
+		}
+
+		builder.WriteByte(value[i])
+	}
+
+	return builder.String()
+}
+
+func isOctal(value string) bool {
+	for i := range len(value) {
+		if value[i] < '0' || value[i] > '7' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -3,8 +3,6 @@ package filesystem
 import (
 	"context"
 	"os"
-	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
@@ -27,14 +25,19 @@ var (
 	_ = (fs.NodeLookuper)((*MusicDir)(nil))
 	_ = (fs.NodeReaddirer)((*MusicDir)(nil))
 	_ = (fs.NodeCreater)((*MusicDir)(nil))
+	_ = (fs.NodeMkdirer)((*MusicDir)(nil))
+	_ = (fs.NodeRmdirer)((*MusicDir)(nil))
+	_ = (fs.NodeUnlinker)((*MusicDir)(nil))
+	_ = (fs.NodeRenamer)((*MusicDir)(nil))
 	_ = (fs.NodeGetxattrer)((*MusicDir)(nil))
 	_ = (fs.NodeSetxattrer)((*MusicDir)(nil))
 	_ = (fs.NodeRemovexattrer)((*MusicDir)(nil))
 	_ = (fs.NodeListxattrer)((*MusicDir)(nil))
+	_ = (fs.NodeStatfser)((*MusicDir)(nil))
 )
 
 func (d *MusicDir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	out.Mode = fuse.S_IFDIR | 0o755
+	out.Mode = d.f.dirMode(0o755)
 	out.Nlink = 2 // Minimum . and ..
 	out.Ino = d.StableAttr().Ino
 	out.Size = 4096
@@ -67,156 +70,46 @@ func (d *MusicDir) Getattr(ctx context.Context, f fs.FileHandle, out *fuse.AttrO
 }
 
 func (d *MusicDir) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
-	// Same implementation as RootDir
-	switch attr {
-	case "user.org.netatalk.Metadata":
-		fallthrough
-	case "com.apple.FinderInfo":
-		fallthrough
-	case "com.apple.ResourceFork":
-		if len(dest) > 0 {
-			return 0, 0
-		}
-
-		return 0, 0
-	default:
-		return 0, syscall.ENODATA
-	}
+	return d.f.getXattr(d.path, attr, dest)
 }
 
 func (d *MusicDir) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
-	return 0
+	return d.f.setXattr(d.path, attr, data, flags)
 }
 
 func (d *MusicDir) Removexattr(ctx context.Context, attr string) syscall.Errno {
-	return 0
+	return d.f.removeXattr(d.path, attr)
 }
 
 func (d *MusicDir) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
-	return 0, 0
+	return d.f.listXattrs(d.path, dest)
 }
 
-func (d *MusicDir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
-	if d.f.isiTunesMetadata(name) {
-		metaPath := filepath.Join(d.f.metadataDir, name)
-
-		file, err := os.Create(metaPath)
-		if err != nil {
-			return nil, nil, 0, syscall.EIO
-		}
+func (d *MusicDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.f.statfs(out)
+}
 
-		ch := d.NewInode(
-			ctx,
-			d.f.NewMusicAppMetadataFile(metaPath),
-			fs.StableAttr{
-				Mode: fuse.S_IFREG,
-				Ino:  d.f.nextInode(),
-			},
-		)
-
-		out.Mode = fuse.S_IFREG | 0o644
-		out.Nlink = 1
-		out.Ino = ch.StableAttr().Ino
-		out.Size = 0
-		out.Mtime = uint64(time.Now().Unix())
-		out.Atime = out.Mtime
-		out.Ctime = out.Mtime
-		out.Blocks = 1
+func (d *MusicDir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
+	if d.f.isClientMetadata(d.path, name) {
+		metaPath, _ := d.metadataChildPath(name)
 
-		return ch, &File{file: file}, fuse.FOPEN_DIRECT_IO, 0
+		return d.f.createMetadata(ctx, &d.Inode, metaPath, flags, mode, out)
 	}
 
 	return nil, nil, 0, syscall.EPERM
 }
 
 func (d *MusicDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	// Handle .m4a virtual files
-	if strings.HasSuffix(strings.ToLower(name), ".m4a") {
-		flacName := name[:len(name)-4] + ".flac"
-		flacPath := filepath.Join(d.path, flacName)
-
-		if _, err := os.Stat(flacPath); err == nil {
-			ch := d.NewInode(
-				ctx,
-				d.f.NewMusicFile(flacPath, name, false),
-				fs.StableAttr{
-					Mode: fuse.S_IFREG,
-					Ino:  d.f.nextInode(),
-				},
-			)
-
-			out.Mode = fuse.S_IFREG | 0o444
-			out.Nlink = 1
-			out.Ino = ch.StableAttr().Ino
-
-			if size, err := d.f.cacher.GetStat(flacPath); err == nil {
-				out.Size = uint64(size)
-			} else {
-				out.Size = 0
-			}
-
-			out.Mtime = uint64(time.Now().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-			out.Blocks = (out.Size + 511) / 512
-
-			return ch, 0
-		}
-	}
-
-	// Check real file or directory
-	fullPath := filepath.Join(d.path, name)
-
-	info, err := os.Stat(fullPath)
-	if err != nil {
-		return nil, syscall.ENOENT
-	}
-
-	if info.IsDir() {
-		ch := d.NewInode(
-			ctx, d.f.NewMusicDirectory(fullPath),
-			fs.StableAttr{
-				Mode: fuse.S_IFDIR,
-				Ino:  d.f.nextInode(),
-			},
-		)
-
-		out.Mode = fuse.S_IFDIR | 0o755
-		out.Nlink = 2
-		out.Ino = ch.StableAttr().Ino
-		out.Size = 4096
-		out.Mtime = uint64(info.ModTime().Unix())
-		out.Atime = out.Mtime
-		out.Ctime = out.Mtime
-		out.Blocks = 1
-
-		return ch, 0
+	entry, ok := d.f.resolveName(d.path, name)
+	if ok {
+		return d.f.lookupSource(ctx, &d.Inode, d.path, entry, out)
 	}
 
-	// Regular file (non-FLAC)
-	isMeta := d.f.isiTunesMetadata(name)
-	ch := d.NewInode(ctx, d.f.NewMusicFile(fullPath, name, isMeta),
-		fs.StableAttr{
-			Mode: fuse.S_IFREG,
-			Ino:  d.f.nextInode(),
-		},
-	)
-
-	if isMeta {
-		out.Mode = fuse.S_IFREG | 0o644
-	} else {
-		out.Mode = fuse.S_IFREG | 0o444
+	if d.f.isClientMetadata(d.path, name) {
+		return d.f.lookupMetadata(ctx, &d.Inode, d.f.metadataPath(d.path, name), out)
 	}
 
-	out.Nlink = 1
-	out.Ino = ch.StableAttr().Ino
-	out.Size = uint64(info.Size())
-	out.Mtime = uint64(info.ModTime().Unix())
-	out.Atime = out.Mtime
-	out.Ctime = out.Mtime
-	out.Blocks = (out.Size + 511) / 512
-
-	return ch, 0
+	return nil, syscall.ENOENT
 }
 
 func (d *MusicDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
@@ -226,52 +119,21 @@ func (d *MusicDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
 
 	dirEntries = append(dirEntries, fuse.DirEntry{
 		Name: ".",
-		Mode: fuse.S_IFDIR | 0o755,
+		Mode: d.f.dirMode(0o755),
 		Ino:  d.StableAttr().Ino,
 	})
 	dirEntries = append(dirEntries, fuse.DirEntry{
 		Name: "..",
-		Mode: fuse.S_IFDIR | 0o755,
-		Ino:  1, // Parent (root) inode
+		Mode: d.f.dirMode(0o755),
+		Ino:  d.f.parentInode(d.path),
 	})
 
-	entries, err := os.ReadDir(d.path)
-	if err != nil {
-		d.f.app.Logger().WithError(err).WithField("path", d.path).Error(
-			"Error reading directory",
-		)
-
-		return fs.NewListDirStream(dirEntries), 0
-	}
+	dirEntries = append(dirEntries, d.f.sourceDirEntries(d.path)...)
 
-	for _, entry := range entries {
-		name := entry.Name()
-
-		if strings.HasPrefix(name, ".") && !d.f.isiTunesMetadata(name) {
-			continue
-		}
-
-		mode := fuse.S_IFREG | 0o444
-		if entry.IsDir() {
-			mode = fuse.S_IFDIR | 0o755
-		}
-
-		// Convert .flac to .m4a in directory listing
-		if strings.HasSuffix(strings.ToLower(name), ".flac") {
-			name = name[:len(name)-5] + ".m4a"
-			if !d.f.isiTunesMetadata(name) {
-				mode = fuse.S_IFREG | 0o644
-			}
-		} else if !d.f.isiTunesMetadata(name) {
-			mode = fuse.S_IFREG | 0o644
-		}
-
-		dirEntries = append(dirEntries, fuse.DirEntry{
-			Name: name,
-			Mode: uint32(mode),
-			Ino:  d.f.nextInode(),
-		})
-	}
+	dirEntries = append(dirEntries, d.f.metadataDirEntries(
+		d.f.metadataPath(d.path, ""),
+		func(name string) bool { return d.f.isClientMetadata(d.path, name) },
+	)...)
 
 	d.f.app.Logger().WithFields(logrus.Fields{
 		"path":              d.path,
@@ -287,3 +149,47 @@ func (f *FS) NewMusicDirectory(path string) *MusicDir {
 		path: path,
 	}
 }
+
+// Only client metadata can be changed, the library content is read-only.
+
+func (d *MusicDir) metadataChildPath(name string) (string, bool) {
+	return d.f.metadataPath(d.path, name), d.f.isClientMetadata(d.path, name)
+}
+
+func (d *MusicDir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return nil, syscall.EPERM
+	}
+
+	return d.f.mkdirMetadata(ctx, &d.Inode, metaPath, mode, out)
+}
+
+func (d *MusicDir) Rmdir(ctx context.Context, name string) syscall.Errno {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return d.f.removeMetadata(metaPath, true)
+}
+
+func (d *MusicDir) Unlink(ctx context.Context, name string) syscall.Errno {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return d.f.removeMetadata(metaPath, false)
+}
+
+func (d *MusicDir) Rename(
+	ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32,
+) syscall.Errno {
+	metaPath, ok := d.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return d.f.renameMetadata(metaPath, newParent, newName, flags)
+}
@@ -2,70 +2,56 @@ package filesystem
 
 import (
 	"context"
+	"maps"
 	"os"
-	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
 )
 
+// infoXattrPrefix is the namespace of the read-only informational attributes
+// of the virtual tracks.
+const infoXattrPrefix = "user.faketunes."
+
 type MusicFile struct {
 	fs.Inode
 
 	f           *FS
 	sourcePath  string
 	virtualName string
-	isMetaFile  bool
 }
 
 var (
 	_ = (fs.NodeGetattrer)((*MusicFile)(nil))
+	_ = (fs.NodeGetxattrer)((*MusicFile)(nil))
+	_ = (fs.NodeSetxattrer)((*MusicFile)(nil))
+	_ = (fs.NodeRemovexattrer)((*MusicFile)(nil))
+	_ = (fs.NodeListxattrer)((*MusicFile)(nil))
+	_ = (fs.NodeStatfser)((*MusicFile)(nil))
 	_ = (fs.NodeOpener)((*MusicFile)(nil))
 	_ = (fs.NodeSetattrer)((*MusicFile)(nil))
 )
 
 func (f *MusicFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
-	if f.isMetaFile {
-		metaPath := filepath.Join(f.f.metadataDir, f.virtualName)
-
-		if info, err := os.Stat(metaPath); err == nil {
-			out.Mode = fuse.S_IFREG | 0o644
-			out.Nlink = 1
-			out.Ino = f.StableAttr().Ino
-			out.Size = uint64(info.Size())
-			out.Mtime = uint64(info.ModTime().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-			out.Blocks = (out.Size + 511) / 512
-		} else {
-			out.Mode = fuse.S_IFREG | 0o644
-			out.Nlink = 1
-			out.Ino = f.StableAttr().Ino
-			out.Size = 0
-			out.Mtime = uint64(time.Now().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-			out.Blocks = 1
-		}
-
-		return 0
-	}
-
-	out.Mode = fuse.S_IFREG | 0o444
+	out.Mode = f.f.fileMode(0o444)
 	out.Nlink = 1
 	out.Ino = f.StableAttr().Ino
 	out.Blocks = 1
 
-	if size, err := f.f.cacher.GetStat(f.sourcePath); err == nil {
-		out.Size = uint64(size)
+	if stat, err := f.f.cacher.GetStat(f.sourcePath); err == nil {
+		out.Size = uint64(stat.Size)
 		out.Blocks = (out.Size + 511) / 512
+		out.Mtime = uint64(stat.ModTime.Unix())
 	} else {
 		out.Size = 0
 	}
 
-	out.Mtime = uint64(time.Now().Unix())
 	out.Atime = out.Mtime
 	out.Ctime = out.Mtime
 
@@ -73,50 +59,10 @@ func (f *MusicFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.Att
 }
 
 func (f *MusicFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
-	if f.isMetaFile {
-		metaPath := filepath.Join(f.f.metadataDir, f.virtualName)
-		if info, err := os.Stat(metaPath); err == nil {
-			out.Mode = fuse.S_IFREG | 0o644
-			out.Nlink = 1
-			out.Ino = f.StableAttr().Ino
-			out.Size = uint64(info.Size())
-			out.Mtime = uint64(info.ModTime().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-			out.Blocks = (out.Size + 511) / 512
-		} else {
-			out.Mode = fuse.S_IFREG | 0o644
-			out.Nlink = 1
-			out.Ino = f.StableAttr().Ino
-			out.Size = 0
-			out.Mtime = uint64(time.Now().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-			out.Blocks = 1
-		}
-
-		return 0
-	}
-
 	return syscall.EPERM
 }
 
 func (f *MusicFile) Open(ctx context.Context, flags uint32) (fh fs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
-	if f.isMetaFile {
-		metaPath := filepath.Join(f.f.metadataDir, f.virtualName)
-
-		file, err := os.OpenFile(metaPath, int(flags), 0o644)
-		if err != nil && os.IsNotExist(err) {
-			file, err = os.Create(metaPath)
-		}
-
-		if err != nil {
-			return nil, 0, syscall.EIO
-		}
-
-		return &File{file: file}, fuse.FOPEN_DIRECT_IO, 0
-	}
-
 	if flags&fuse.O_ANYWRITE != 0 {
 		return nil, 0, syscall.EPERM
 	}
@@ -136,14 +82,77 @@ func (f *MusicFile) Open(ctx context.Context, flags uint32) (fh fs.FileHandle, f
 		return nil, 0, syscall.EIO
 	}
 
-	return &File{file: file}, fuse.FOPEN_KEEP_CACHE, 0
+	return f.f.NewBackingFile(file), fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (f *MusicFile) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	if strings.HasPrefix(attr, infoXattrPrefix) {
+		value, ok := f.infoXattrs()[attr]
+		if !ok {
+			return 0, syscall.ENODATA
+		}
+
+		return copyXattrValue([]byte(value), dest)
+	}
+
+	return f.f.getXattr(f.sourcePath, attr, dest)
+}
+
+func (f *MusicFile) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	if strings.HasPrefix(attr, infoXattrPrefix) {
+		return syscall.EPERM
+	}
+
+	return f.f.setXattr(f.sourcePath, attr, data, flags)
+}
+
+func (f *MusicFile) Removexattr(ctx context.Context, attr string) syscall.Errno {
+	if strings.HasPrefix(attr, infoXattrPrefix) {
+		return syscall.EPERM
+	}
+
+	return f.f.removeXattr(f.sourcePath, attr)
+}
+
+func (f *MusicFile) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	attrs := slices.Sorted(maps.Keys(f.infoXattrs()))
+
+	return copyXattrNames(append(attrs, f.f.xattrNames(f.sourcePath)...), dest)
+}
+
+func (f *MusicFile) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return f.f.statfs(out)
+}
+
+// infoXattrs returns the read-only attributes telling where the track comes
+// from and how it's transcoded. Gathering them never triggers a transcode.
+func (f *MusicFile) infoXattrs() map[string]string {
+	attrs := map[string]string{
+		infoXattrPrefix + "source_path": f.sourcePath,
+	}
+
+	if info, err := f.f.cacher.GetCacheInfo(f.sourcePath); err == nil {
+		attrs[infoXattrPrefix+"cache_key"] = info.Key
+		attrs[infoXattrPrefix+"cache_state"] = info.State
+		attrs[infoXattrPrefix+"profile"] = info.Profile
+
+		if !info.Transcoded.IsZero() {
+			attrs[infoXattrPrefix+"transcoded_at"] = info.Transcoded.UTC().Format(time.RFC3339)
+		}
+	}
+
+	if streamInfo, err := flac.ReadStreamInfo(f.sourcePath); err == nil {
+		attrs[infoXattrPrefix+"source_sample_rate"] = strconv.Itoa(streamInfo.SampleRate)
+		attrs[infoXattrPrefix+"source_bit_depth"] = strconv.Itoa(streamInfo.BitsPerSample)
+	}
+
+	return attrs
 }
 
-func (f *FS) NewMusicFile(sourcePath, virtualName string, isMetaFile bool) *MusicFile {
+func (f *FS) NewMusicFile(sourcePath, virtualName string) *MusicFile {
 	return &MusicFile{
 		f:           f,
 		sourcePath:  sourcePath,
 		virtualName: virtualName,
-		isMetaFile:  isMetaFile,
 	}
 }
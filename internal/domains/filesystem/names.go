@@ -0,0 +1,348 @@
+package filesystem
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+)
+
+// nameIndexMaxDirs limits the amount of remembered directory indexes, they
+// are rebuilt on demand.
+const nameIndexMaxDirs = 10000
+
+// nameEntry is the source directory entry under its virtual name.
+type nameEntry struct {
+	sourceName  string
+	virtualName string
+	isDir       bool
+	isFLAC      bool
+}
+
+// nameIndex maps the virtual names of the source directory entries to the
+// entries. It's valid while the directory modification time stays the same.
+type nameIndex struct {
+	modTime  time.Time
+	entries  []*nameEntry
+	exact    map[string]*nameEntry
+	folded   map[string]*nameEntry
+	bySource map[string]*nameEntry
+}
+
+// plainName returns the name the source entry is known to the clients by,
+// before sanitizing and shortening.
+func (f *FS) plainName(sourceName string) string {
+	name := sourceName
+	if strings.HasSuffix(strings.ToLower(name), ".flac") {
+		name = name[:len(name)-5] + ".m4a"
+	}
+
+	switch f.names.Normalization {
+	case configuration.NormalizationNFC:
+		return norm.NFC.String(name)
+	case configuration.NormalizationNFD:
+		return norm.NFD.String(name)
+	default:
+		return name
+	}
+}
+
+// virtualName returns the name the source entry is listed with: the plain
+// name, sanitized and shortened to the name and path length limits.
+func (f *FS) virtualName(sourceDir, sourceName string) string {
+	return f.limitedName(sourceName, f.nameLengthLimit(sourceDir))
+}
+
+func (f *FS) limitedName(sourceName string, limit int) string {
+	name := f.plainName(sourceName)
+
+	if f.names.Sanitize {
+		name = sanitizeName(name, f.names.Replacement)
+	}
+
+	if nameLength(name) > limit {
+		name = shortenName(name, sourceName, limit)
+	}
+
+	return name
+}
+
+// nameLengthLimit returns the longest name allowed in the source directory,
+// so the virtual path fits into the path length limit.
+func (f *FS) nameLengthLimit(sourceDir string) int {
+	return f.nameLimit(f.virtualPathLength(sourceDir))
+}
+
+// nameLimit returns the longest name allowed in the virtual directory with
+// the path of the given length.
+func (f *FS) nameLimit(dirPathLength int) int {
+	limit := f.names.MaxNameLength
+
+	if f.names.MaxPathLength > 0 {
+		budget := f.names.MaxPathLength - dirPathLength
+		limit = max(min(limit, budget), configuration.MinNameLength)
+	}
+
+	return limit
+}
+
+// virtualPathLength returns the length of the virtual path of the source
+// directory from the mount root, including the trailing separator.
+func (f *FS) virtualPathLength(sourceDir string) int {
+	relPath, err := filepath.Rel(f.sourceDir, sourceDir)
+	if err != nil || relPath == "." {
+		return 0
+	}
+
+	parent := filepath.Dir(sourceDir)
+
+	return f.virtualPathLength(parent) + nameLength(f.listedName(parent, filepath.Base(sourceDir))) + 1
+}
+
+// mirroredPath returns the path of the source file in the mirrored tree from
+// the mount root, made of the listed names. It returns false if the file or
+// any of its parent directories isn't listed: it's hidden or loses a name
+// collision.
+func (f *FS) mirroredPath(sourcePath string) (string, bool) {
+	relPath, err := filepath.Rel(f.sourceDir, sourcePath)
+	if err != nil || relPath == "." {
+		return "", true
+	}
+
+	parent := filepath.Dir(sourcePath)
+
+	parentPath, ok := f.mirroredPath(parent)
+	if !ok {
+		return "", false
+	}
+
+	index, err := f.nameIndex(parent)
+	if err != nil {
+		return "", false
+	}
+
+	entry, ok := index.bySource[filepath.Base(sourcePath)]
+	if !ok {
+		return "", false
+	}
+
+	return filepath.Join(parentPath, entry.virtualName), true
+}
+
+// listedName returns the name the source entry is currently listed with.
+// The entries which are gone get the name they would have.
+func (f *FS) listedName(sourceDir, sourceName string) string {
+	if index, err := f.nameIndex(sourceDir); err == nil {
+		if entry, ok := index.bySource[sourceName]; ok {
+			return entry.virtualName
+		}
+	}
+
+	return f.virtualName(sourceDir, sourceName)
+}
+
+// foldName returns the key the names are matched by: names differing only in
+// Unicode normalization form or, optionally, in case get the same key.
+func (f *FS) foldName(name string) string {
+	if f.names.Normalization != configuration.NormalizationNone {
+		name = norm.NFC.String(name)
+	}
+
+	if f.names.CaseInsensitive {
+		name = cases.Fold().String(name)
+	}
+
+	return name
+}
+
+// resolveName finds the source directory entry for the virtual name. The
+// exact name is preferred, then the one matching by the folded name.
+func (f *FS) resolveName(sourceDir, name string) (*nameEntry, bool) {
+	index, err := f.nameIndex(sourceDir)
+	if err != nil {
+		return nil, false
+	}
+
+	if entry, ok := index.exact[name]; ok {
+		return entry, true
+	}
+
+	entry, ok := index.folded[f.foldName(name)]
+
+	return entry, ok
+}
+
+// nameIndex returns the name index of the source directory, rebuilding it if
+// the directory was changed.
+func (f *FS) nameIndex(sourceDir string) (*nameIndex, error) {
+	info, err := os.Stat(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	f.nameIndexesMutex.Lock()
+	index, ok := f.nameIndexes[sourceDir]
+	f.nameIndexesMutex.Unlock()
+
+	if ok && index.modTime.Equal(info.ModTime()) {
+		return index, nil
+	}
+
+	index, err = f.buildNameIndex(sourceDir, info.ModTime())
+	if err != nil {
+		return nil, err
+	}
+
+	f.nameIndexesMutex.Lock()
+	defer f.nameIndexesMutex.Unlock()
+
+	if len(f.nameIndexes) >= nameIndexMaxDirs {
+		clear(f.nameIndexes)
+	}
+
+	f.nameIndexes[sourceDir] = index
+
+	return index, nil
+}
+
+// forgetNameIndexes drops the name indexes affected by the change of the
+// source path. The directory mtime has a coarse resolution on some
+// filesystems, so it can't be trusted alone.
+func (f *FS) forgetNameIndexes(sourcePath string) {
+	f.nameIndexesMutex.Lock()
+	defer f.nameIndexesMutex.Unlock()
+
+	delete(f.nameIndexes, filepath.Dir(sourcePath))
+	delete(f.nameIndexes, sourcePath)
+}
+
+// buildNameIndex reads the source directory. When several entries get the
+// same virtual name, the names left as is win over the sanitized ones, FLACs
+// win over the other files, and then the first source name in byte order
+// wins. The sanitized losers get the hash suffix, the rest are not listed
+// and logged.
+func (f *FS) buildNameIndex(sourceDir string, modTime time.Time) (*nameIndex, error) {
+	dirEntries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := f.nameLengthLimit(sourceDir)
+	entries := make([]*nameEntry, 0, len(dirEntries))
+
+	for _, dirEntry := range dirEntries {
+		if strings.HasPrefix(dirEntry.Name(), ".") || f.isHiddenSourceFile(sourceDir, dirEntry) {
+			continue
+		}
+
+		isDir := isSourceDir(sourceDir, dirEntry)
+
+		entries = append(entries, &nameEntry{
+			sourceName:  dirEntry.Name(),
+			virtualName: f.limitedName(dirEntry.Name(), limit),
+			isDir:       isDir,
+			isFLAC:      !isDir && strings.HasSuffix(strings.ToLower(dirEntry.Name()), ".flac"),
+		})
+	}
+
+	slices.SortStableFunc(entries, func(a, b *nameEntry) int {
+		aPlain := a.virtualName == f.plainName(a.sourceName)
+		bPlain := b.virtualName == f.plainName(b.sourceName)
+
+		switch {
+		case aPlain != bPlain:
+			return boolOrder(aPlain)
+		case a.isFLAC != b.isFLAC:
+			return boolOrder(a.isFLAC)
+		default:
+			return strings.Compare(a.sourceName, b.sourceName)
+		}
+	})
+
+	index := &nameIndex{
+		modTime:  modTime,
+		entries:  make([]*nameEntry, 0, len(entries)),
+		exact:    make(map[string]*nameEntry, len(entries)),
+		folded:   make(map[string]*nameEntry, len(entries)),
+		bySource: make(map[string]*nameEntry, len(entries)),
+	}
+
+	for _, entry := range entries {
+		key := f.foldName(entry.virtualName)
+
+		// Names changed by sanitizing or shortening weren't chosen by the
+		// user, the colliding ones are told apart by the hash suffix.
+		if _, ok := index.folded[key]; ok && entry.virtualName != f.plainName(entry.sourceName) {
+			entry.virtualName = shortenName(entry.virtualName, entry.sourceName, limit)
+			key = f.foldName(entry.virtualName)
+		}
+
+		if winner, ok := index.folded[key]; ok {
+			f.app.Logger().WithFields(logrus.Fields{
+				"directory":   sourceDir,
+				"source file": entry.sourceName,
+				"shadowed by": winner.sourceName,
+			}).Warn("Source file name collides with another one and is hidden")
+
+			continue
+		}
+
+		index.folded[key] = entry
+		index.exact[entry.virtualName] = entry
+		index.bySource[entry.sourceName] = entry
+		index.entries = append(index.entries, entry)
+	}
+
+	slices.SortFunc(index.entries, func(a, b *nameEntry) int {
+		return strings.Compare(a.virtualName, b.virtualName)
+	})
+
+	return index, nil
+}
+
+// sourceDirEntries lists the source directory under the virtual names.
+func (f *FS) sourceDirEntries(sourceDir string) []fuse.DirEntry {
+	index, err := f.nameIndex(sourceDir)
+	if err != nil {
+		f.app.Logger().WithError(err).WithField("path", sourceDir).Error(
+			"Error reading directory",
+		)
+
+		return nil
+	}
+
+	dirEntries := make([]fuse.DirEntry, 0, len(index.entries))
+
+	for _, entry := range index.entries {
+		mode := f.fileMode(0o444)
+		if entry.isDir {
+			mode = f.dirMode(0o755)
+		}
+
+		ino, _ := f.inode(filepath.Join(sourceDir, entry.sourceName))
+
+		dirEntries = append(dirEntries, fuse.DirEntry{
+			Name: entry.virtualName,
+			Mode: mode,
+			Ino:  ino,
+		})
+	}
+
+	return dirEntries
+}
+
+// boolOrder sorts the entries having the property first.
+func boolOrder(first bool) int {
+	if first {
+		return -1
+	}
+
+	return 1
+}
@@ -0,0 +1,201 @@
+package filesystem
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/sirupsen/logrus"
+)
+
+// layoutRefreshInterval is how often the layout tree is checked for changes.
+// It's longer than the library index update interval, so the changes are
+// usually indexed by then.
+const layoutRefreshInterval = 5 * time.Second
+
+// InvalidateSource makes the kernel forget the cached entry, attributes and
+// content of the virtual file or directory backed by the source path, so the
+// next access sees the current state of the source library.
+func (f *FS) InvalidateSource(sourcePath string) {
+	f.libraryStatsDirty.Store(true)
+	f.forgetNameIndexes(sourcePath)
+
+	if _, err := os.Lstat(sourcePath); errors.Is(err, os.ErrNotExist) {
+		f.dropXattrs(sourcePath)
+	}
+
+	// The layout tree doesn't follow the source paths, the kernel is
+	// notified about its changes after it's rebuilt.
+	if f.layoutTemplate != nil || f.hasViews() {
+		f.layoutChangesMutex.Lock()
+		f.layoutChanges[sourcePath] = struct{}{}
+		f.layoutChangesMutex.Unlock()
+	}
+
+	root := f.root.Load()
+	if root == nil || f.layoutTemplate != nil {
+		return
+	}
+
+	relPath, err := filepath.Rel(f.sourceDir, sourcePath)
+	if err != nil || relPath == "." || strings.HasPrefix(relPath, "..") {
+		return
+	}
+
+	parts := strings.Split(relPath, string(filepath.Separator))
+
+	// If the kernel never looked up some parent directory, it has nothing
+	// cached below it.
+	parent := &root.Inode
+	sourceDir := f.sourceDir
+
+	for _, part := range parts[:len(parts)-1] {
+		parent = parent.GetChild(f.listedName(sourceDir, part))
+		if parent == nil {
+			return
+		}
+
+		sourceDir = filepath.Join(sourceDir, part)
+	}
+
+	name := f.listedName(sourceDir, parts[len(parts)-1])
+
+	if child := parent.GetChild(name); child != nil {
+		f.logNotifyError(child.NotifyContent(0, 0), sourcePath)
+	}
+
+	f.logNotifyError(parent.NotifyEntry(name), sourcePath)
+	f.logNotifyError(parent.NotifyContent(0, 0), sourcePath)
+}
+
+func (f *FS) logNotifyError(errno syscall.Errno, path string) {
+	// ENOENT means the kernel has already dropped the object from its caches.
+	if errno == fs.OK || errno == syscall.ENOENT {
+		return
+	}
+
+	f.app.Logger().WithFields(logrus.Fields{
+		"path":  path,
+		"errno": errno,
+	}).Debug("Failed to invalidate kernel cache")
+}
+
+// MoveSource carries the extended attributes of the renamed source file or
+// directory, and everything below it, over to the new path.
+func (f *FS) MoveSource(oldPath, newPath string) {
+	f.moveXattrs(oldPath, newPath, false)
+}
+
+// refreshLayout rebuilds the layout tree after the library changes, and makes
+// the kernel forget the changed layout entries, until the application is
+// stopped. Nothing would look them up again while the kernel caches them.
+func (f *FS) refreshLayout() {
+	ticker := time.NewTicker(layoutRefreshInterval)
+	defer ticker.Stop()
+
+	// shown is the layout tree the kernel knows about.
+	var shown *layoutTree
+
+	for {
+		select {
+		case <-f.app.Context().Done():
+			return
+		case <-ticker.C:
+			shown = f.notifyLayoutChanges(shown)
+		}
+	}
+}
+
+// notifyLayoutChanges brings the layout tree up to date and notifies the
+// kernel about the differences from the shown tree. It returns the new shown
+// tree.
+func (f *FS) notifyLayoutChanges(shown *layoutTree) *layoutTree {
+	f.layoutChangesMutex.Lock()
+	changes := f.layoutChanges
+	f.layoutChanges = make(map[string]struct{}, 0)
+	f.layoutChangesMutex.Unlock()
+
+	// The kernel has nothing cached until the layout is looked up.
+	root := f.root.Load()
+	if root == nil || f.layoutTree.Load() == nil {
+		return nil
+	}
+
+	if shown == nil {
+		shown = f.layoutTree.Load()
+	}
+
+	tree := f.currentLayout()
+	if len(changes) > 0 && tree.version == shown.version {
+		tree = f.rebuildLayout()
+	}
+
+	if tree != shown || len(changes) > 0 {
+		f.notifyLayoutDir(&root.Inode, shown.root, tree.root, changes)
+	}
+
+	return tree
+}
+
+// notifyLayoutDir makes the kernel forget the entries of the layout directory
+// which are gone, added or changed, and its listing if any of them changed.
+// The changed source files get their content dropped.
+func (f *FS) notifyLayoutDir(node *fs.Inode, shown, dir *layoutDir, changes map[string]struct{}) {
+	changed := false
+
+	forget := func(name string) {
+		changed = true
+
+		f.logNotifyError(node.NotifyEntry(name), filepath.Join(dir.path, name))
+	}
+
+	for name, shownChild := range shown.dirs {
+		child, ok := dir.dirs[name]
+		if !ok {
+			forget(name)
+
+			continue
+		}
+
+		if childNode := node.GetChild(name); childNode != nil {
+			f.notifyLayoutDir(childNode, shownChild, child, changes)
+		}
+	}
+
+	for name, shownFile := range shown.files {
+		file, ok := dir.files[name]
+		if !ok || file.sourcePath != shownFile.sourcePath {
+			forget(name)
+
+			continue
+		}
+
+		_, sourceChanged := changes[file.sourcePath]
+		if !sourceChanged && bytes.Equal(file.playlist, shownFile.playlist) {
+			continue
+		}
+
+		if childNode := node.GetChild(name); childNode != nil {
+			f.logNotifyError(childNode.NotifyContent(0, 0), filepath.Join(dir.path, name))
+		}
+	}
+
+	for _, name := range dir.names {
+		_, isShownDir := shown.dirs[name]
+		_, isShownFile := shown.files[name]
+
+		if !isShownDir && !isShownFile {
+			// The kernel may remember that the name doesn't exist.
+			forget(name)
+		}
+	}
+
+	if changed {
+		f.logNotifyError(node.NotifyContent(0, 0), dir.path)
+	}
+}
@@ -0,0 +1,30 @@
+package filesystem
+
+import (
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// fileMode returns the mode of the regular file with the file umask from the
+// mount configuration applied.
+func (f *FS) fileMode(perm uint32) uint32 {
+	return fuse.S_IFREG | perm&^uint32(f.mountConfig.FileUmask)
+}
+
+// dirMode returns the mode of the directory with the directory umask from the
+// mount configuration applied.
+func (f *FS) dirMode(perm uint32) uint32 {
+	return fuse.S_IFDIR | perm&^uint32(f.mountConfig.DirUmask)
+}
+
+// applyOwnership replaces the owner of the object with the one forced in the
+// mount configuration. go-fuse only fills the owner of the virtual objects,
+// the client metadata keeps the owner from the store.
+func (f *FS) applyOwnership(out *fuse.Attr) {
+	if f.mountConfig.UID != nil {
+		out.Uid = *f.mountConfig.UID
+	}
+
+	if f.mountConfig.GID != nil {
+		out.Gid = *f.mountConfig.GID
+	}
+}
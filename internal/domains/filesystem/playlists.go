@@ -0,0 +1,183 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/query"
+)
+
+const playlistsDirName = "Playlists"
+
+// smartPlaylist is the playlist of the tracks matching the query.
+type smartPlaylist struct {
+	name  string
+	query *query.Query
+}
+
+// newSmartPlaylists prepares the playlists defined in the config.
+func newSmartPlaylists(config configuration.Playlists) ([]*smartPlaylist, error) {
+	playlists := make([]*smartPlaylist, 0, len(config))
+
+	for _, playlist := range config {
+		q, err := query.Parse(playlist.Query, searchTextFields)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w (playlist %q: %w)", ErrFilesystem, ErrInvalidPlaylist, playlist.Name, err)
+		}
+
+		playlists = append(playlists, &smartPlaylist{name: playlist.Name, query: q})
+	}
+
+	return playlists, nil
+}
+
+// addPlaylists adds the playlist files to the directory. The tracks are
+// referred to by the paths relative to the directory, so the playlists work
+// wherever the mount is shared.
+func (f *FS) addPlaylists(dir *layoutDir, tracks []*dto.Track, paths map[string]string) {
+	for _, playlist := range f.playlists {
+		content := f.renderPlaylist(playlist, tracks, paths)
+
+		if _, ok := dir.addFile(f, playlist.name+".m3u8", &layoutFile{playlist: content}); !ok {
+			f.app.Logger().WithField("playlist", playlist.name).Warn("Playlist name collides with another one and is hidden")
+		}
+	}
+}
+
+// renderPlaylist returns the M3U8 playlist of the tracks matching the query,
+// in the library order. The tracks hidden from the layout are skipped.
+func (f *FS) renderPlaylist(playlist *smartPlaylist, tracks []*dto.Track, paths map[string]string) []byte {
+	var content bytes.Buffer
+
+	content.WriteString("#EXTM3U\n")
+
+	for _, track := range tracks {
+		fields := &trackFields{f: f, track: track}
+		if !playlist.query.Match(fields) {
+			continue
+		}
+
+		path, ok := paths[track.SourcePath]
+		if !ok && f.layoutTemplate == nil {
+			path, ok = f.mirroredPath(track.SourcePath)
+		}
+
+		if !ok {
+			continue
+		}
+
+		// The display names aren't paths, the tag values are kept as is.
+		artist := strings.TrimSpace(fields.rawField("artist"))
+		title := strings.TrimSpace(fields.rawField("title"))
+
+		fmt.Fprintf(&content, "#EXTINF:-1,%s - %s\n../%s\n", artist, title, path)
+	}
+
+	return content.Bytes()
+}
+
+// PlaylistFile is the smart playlist generated from the library index. It's
+// regenerated with the layout tree, every open gets the current content.
+type PlaylistFile struct {
+	fs.Inode
+
+	f    *FS
+	path string
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*PlaylistFile)(nil))
+	_ = (fs.NodeOpener)((*PlaylistFile)(nil))
+	_ = (fs.NodeStatfser)((*PlaylistFile)(nil))
+)
+
+func (p *PlaylistFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	tree := p.f.currentLayout()
+
+	file, ok := tree.findFile(p.f, p.path)
+	if !ok || file.playlist == nil {
+		return syscall.ENOENT
+	}
+
+	p.f.fillPlaylistAttr(tree, file, p.StableAttr().Ino, &out.Attr)
+
+	return 0
+}
+
+func (p *PlaylistFile) Open(ctx context.Context, flags uint32) (fh fs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
+	if flags&fuse.O_ANYWRITE != 0 {
+		return nil, 0, syscall.EPERM
+	}
+
+	file, ok := p.f.currentLayout().findFile(p.f, p.path)
+	if !ok || file.playlist == nil {
+		return nil, 0, syscall.ENOENT
+	}
+
+	return &PlaylistHandle{content: file.playlist}, 0, 0
+}
+
+func (p *PlaylistFile) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return p.f.statfs(out)
+}
+
+func (f *FS) NewPlaylistFile(path string) *PlaylistFile {
+	return &PlaylistFile{
+		f:    f,
+		path: path,
+	}
+}
+
+// PlaylistHandle is the read-only handle of the playlist content generated
+// when the file was opened.
+type PlaylistHandle struct {
+	content []byte
+}
+
+var _ = (fs.FileReader)((*PlaylistHandle)(nil))
+
+func (h *PlaylistHandle) Read(ctx context.Context, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	if off >= int64(len(h.content)) {
+		return fuse.ReadResultData(nil), 0
+	}
+
+	end := min(off+int64(len(dest)), int64(len(h.content)))
+
+	return fuse.ReadResultData(h.content[off:end]), 0
+}
+
+// findFile returns the file at the path of the layout tree.
+func (t *layoutTree) findFile(f *FS, path string) (*layoutFile, bool) {
+	dir, ok := t.root.find(f, filepath.Dir(path))
+	if !ok {
+		return nil, false
+	}
+
+	name, ok := dir.resolve(f, filepath.Base(path))
+	if !ok {
+		return nil, false
+	}
+
+	file, ok := dir.files[name]
+
+	return file, ok
+}
+
+func (f *FS) fillPlaylistAttr(tree *layoutTree, file *layoutFile, ino uint64, out *fuse.Attr) {
+	out.Mode = f.fileMode(0o444)
+	out.Nlink = 1
+	out.Ino = ino
+	out.Size = uint64(len(file.playlist))
+	out.Mtime = uint64(tree.built.Unix())
+	out.Atime = out.Mtime
+	out.Ctime = out.Mtime
+	out.Blocks = (out.Size + 511) / 512
+}
@@ -3,8 +3,6 @@ package filesystem
 import (
 	"context"
 	"os"
-	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
@@ -24,163 +22,50 @@ var (
 	_ = (fs.NodeLookuper)((*RootDirectory)(nil))
 	_ = (fs.NodeReaddirer)((*RootDirectory)(nil))
 	_ = (fs.NodeCreater)((*RootDirectory)(nil))
+	_ = (fs.NodeMkdirer)((*RootDirectory)(nil))
+	_ = (fs.NodeRmdirer)((*RootDirectory)(nil))
+	_ = (fs.NodeUnlinker)((*RootDirectory)(nil))
+	_ = (fs.NodeRenamer)((*RootDirectory)(nil))
 	_ = (fs.NodeGetxattrer)((*RootDirectory)(nil))
 	_ = (fs.NodeSetxattrer)((*RootDirectory)(nil))
 	_ = (fs.NodeRemovexattrer)((*RootDirectory)(nil))
 	_ = (fs.NodeListxattrer)((*RootDirectory)(nil))
+	_ = (fs.NodeStatfser)((*RootDirectory)(nil))
 )
 
 func (r *RootDirectory) Create(
 	ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut,
 ) (*fs.Inode, fs.FileHandle, uint32, syscall.Errno) {
-	if r.f.isiTunesMetadata(name) {
-		metaPath := filepath.Join(r.f.metadataDir, name)
-
-		file, err := os.Create(metaPath)
-		if err != nil {
-			return nil, nil, 0, syscall.EIO
-		}
-
-		ch := r.NewInode(
-			ctx,
-			r.f.NewMusicAppMetadataFile(metaPath),
-			fs.StableAttr{
-				Mode: fuse.S_IFREG,
-				Ino:  r.f.nextInode(),
-			},
-		)
-
-		out.Mode = fuse.S_IFREG | 0o644
-		out.Nlink = 1
-		out.Ino = ch.StableAttr().Ino
-		out.Size = 0
-		out.Mtime = uint64(time.Now().Unix())
-		out.Atime = out.Mtime
-		out.Ctime = out.Mtime
-		out.Blocks = 1
-
-		return ch, &File{file: file}, fuse.FOPEN_DIRECT_IO, 0
+	if metaPath, ok := r.metadataChildPath(name); ok {
+		return r.f.createMetadata(ctx, &r.Inode, metaPath, flags, mode, out)
 	}
 
 	return nil, nil, 0, syscall.EPERM
 }
 
 func (r *RootDirectory) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	if r.f.isiTunesMetadata(name) {
-		metaPath := filepath.Join(r.f.metadataDir, name)
-		ch := r.NewInode(
-			ctx,
-			r.f.NewMusicAppMetadataFile(metaPath),
-			fs.StableAttr{
-				Mode: fuse.S_IFREG,
-				Ino:  r.f.nextInode(),
-			},
-		)
-
-		out.Mode = fuse.S_IFREG | 0o644
-		out.Nlink = 1
-		out.Ino = ch.StableAttr().Ino
-
-		if info, err := os.Stat(metaPath); err == nil {
-			out.Size = uint64(info.Size())
-			out.Mtime = uint64(info.ModTime().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-		} else {
-			out.Size = 0
-			out.Mtime = uint64(time.Now().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-		}
-
-		// Calculate blocks
-		out.Blocks = (out.Size + 511) / 512
+	if name == searchDirName && r.f.searchTemplate != nil {
+		ch := r.NewInode(ctx, r.f.NewSearchDirectory(), r.f.stableAttr(r.f.searchKey(), fuse.S_IFDIR))
+		r.f.fillSearchDirAttr(ch.StableAttr().Ino, &out.Attr)
 
 		return ch, 0
 	}
 
-	// Handle .m4a virtual files
-	if strings.HasSuffix(strings.ToLower(name), ".m4a") {
-		flacName := name[:len(name)-4] + ".flac"
-		flacPath := filepath.Join(r.f.sourceDir, flacName)
-
-		if _, err := os.Stat(flacPath); err == nil {
-			ch := r.NewInode(
-				ctx,
-				r.f.NewMusicFile(flacPath, name, false),
-				fs.StableAttr{
-					Mode: fuse.S_IFREG,
-					Ino:  r.f.nextInode(),
-				},
-			)
-
-			out.Mode = fuse.S_IFREG | 0o444
-			out.Nlink = 1
-			out.Ino = ch.StableAttr().Ino
-
-			if size, err := r.f.cacher.GetStat(flacPath); err == nil {
-				out.Size = uint64(size)
-			} else {
-				out.Size = 0
-			}
-
-			out.Mtime = uint64(time.Now().Unix())
-			out.Atime = out.Mtime
-			out.Ctime = out.Mtime
-			out.Blocks = (out.Size + 511) / 512
-
-			return ch, 0
-		}
-	}
-
-	// Check real file or directory
-	fullPath := filepath.Join(r.f.sourceDir, name)
-
-	info, err := os.Stat(fullPath)
-	if err != nil {
-		return nil, syscall.ENOENT
+	// The views win over the source entries with the same names.
+	if r.f.layoutTemplate != nil || r.f.isView(name) {
+		return r.f.lookupLayout(ctx, &r.Inode, "", name, out)
 	}
 
-	if info.IsDir() {
-		ch := r.NewInode(ctx, r.f.NewMusicDirectory(fullPath), fs.StableAttr{
-			Mode: fuse.S_IFDIR,
-			Ino:  r.f.nextInode(),
-		})
-
-		out.Mode = fuse.S_IFDIR | 0o755
-		out.Nlink = 2 // Minimum . and ..
-		out.Ino = ch.StableAttr().Ino
-		out.Size = 4096
-		out.Mtime = uint64(info.ModTime().Unix())
-		out.Atime = out.Mtime
-		out.Ctime = out.Mtime
-		out.Blocks = 1
-
-		return ch, 0
+	if r.f.isClientMetadata(r.f.sourceDir, name) {
+		return r.f.lookupMetadata(ctx, &r.Inode, r.f.metadataPath(r.f.sourceDir, name), out)
 	}
 
-	// Regular file (non-FLAC)
-	isMeta := r.f.isiTunesMetadata(name)
-	ch := r.NewInode(ctx, r.f.NewMusicFile(fullPath, name, isMeta), fs.StableAttr{
-		Mode: fuse.S_IFREG,
-		Ino:  r.f.nextInode(),
-	})
-
-	if isMeta {
-		out.Mode = fuse.S_IFREG | 0o644
-	} else {
-		out.Mode = fuse.S_IFREG | 0o444
+	entry, ok := r.f.resolveName(r.f.sourceDir, name)
+	if !ok {
+		return nil, syscall.ENOENT
 	}
 
-	out.Nlink = 1
-	out.Ino = ch.StableAttr().Ino
-	out.Size = uint64(info.Size())
-	out.Mtime = uint64(info.ModTime().Unix())
-	out.Atime = out.Mtime
-	out.Ctime = out.Mtime
-	out.Blocks = (out.Size + 511) / 512
-
-	return ch, 0
+	return r.f.lookupSource(ctx, &r.Inode, r.f.sourceDir, entry, out)
 }
 
 func (r *RootDirectory) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
@@ -191,49 +76,37 @@ func (r *RootDirectory) Readdir(ctx context.Context) (fs.DirStream, syscall.Errn
 	// Always include . and .. first
 	dirEntries = append(dirEntries, fuse.DirEntry{
 		Name: ".",
-		Mode: fuse.S_IFDIR | 0o755,
+		Mode: r.f.dirMode(0o755),
 		Ino:  1, // Root inode
 	})
 	dirEntries = append(dirEntries, fuse.DirEntry{
 		Name: "..",
-		Mode: fuse.S_IFDIR | 0o755,
+		Mode: r.f.dirMode(0o755),
 		Ino:  1,
 	})
 
-	// Read actual directory contents
-	entries, err := os.ReadDir(r.f.sourceDir)
-	if err != nil {
-		r.f.app.Logger().WithError(err).WithField("path", r.f.sourceDir).Error(
-			"Error reading directory",
-		)
-
-		return fs.NewListDirStream(dirEntries), 0
-	}
-
-	for _, entry := range entries {
-		name := entry.Name()
-
-		if strings.HasPrefix(name, ".") && !r.f.isiTunesMetadata(name) {
-			continue
-		}
-
-		mode := fuse.S_IFREG | 0o444
-		if entry.IsDir() {
-			mode = fuse.S_IFDIR | 0o755
+	if r.f.layoutTemplate != nil {
+		dirEntries = append(dirEntries, r.f.layoutDirEntries("")...)
+	} else {
+		for _, entry := range r.f.sourceDirEntries(r.f.sourceDir) {
+			if !r.f.isView(entry.Name) {
+				dirEntries = append(dirEntries, entry)
+			}
 		}
 
-		// Convert .flac to .m4a in directory listing
-		if strings.HasSuffix(strings.ToLower(name), ".flac") {
-			name = name[:len(name)-5] + ".m4a"
+		if r.f.hasViews() {
+			dirEntries = append(dirEntries, r.f.layoutEntries("")...)
 		}
 
-		mode = fuse.S_IFREG | 0o644
+		dirEntries = append(dirEntries, r.f.metadataDirEntries(
+			r.f.metadataPath(r.f.sourceDir, ""),
+			func(name string) bool { return r.f.isClientMetadata(r.f.sourceDir, name) },
+		)...)
+	}
 
-		dirEntries = append(dirEntries, fuse.DirEntry{
-			Name: name,
-			Mode: uint32(mode),
-			Ino:  r.f.nextInode(),
-		})
+	if r.f.searchTemplate != nil {
+		ino, _ := r.f.inode(r.f.searchKey())
+		dirEntries = append(dirEntries, fuse.DirEntry{Name: searchDirName, Mode: r.f.dirMode(0o755), Ino: ino})
 	}
 
 	r.f.app.Logger().WithFields(logrus.Fields{
@@ -248,7 +121,7 @@ func (r *RootDirectory) Getattr(
 	ctx context.Context, f fs.FileHandle, out *fuse.AttrOut,
 ) syscall.Errno {
 	// Set basic directory attributes
-	out.Mode = fuse.S_IFDIR | 0o755
+	out.Mode = r.f.dirMode(0o755)
 
 	// Set nlink to at least 2 (for . and ..)
 	out.Nlink = 2
@@ -259,11 +132,16 @@ func (r *RootDirectory) Getattr(
 	// Set size to typical directory size
 	out.Size = 4096
 
-	// Set timestamps
-	now := uint64(time.Now().Unix())
-	out.Mtime = now
-	out.Atime = now
-	out.Ctime = now
+	// Set timestamps from the source directory, so they don't change on
+	// every call
+	if info, err := os.Stat(r.f.sourceDir); err == nil {
+		out.Mtime = uint64(info.ModTime().Unix())
+	} else {
+		out.Mtime = uint64(time.Now().Unix())
+	}
+
+	out.Atime = out.Mtime
+	out.Ctime = out.Mtime
 
 	// Set blocks (1 block of 512 bytes each = 512 bytes)
 	out.Blocks = 1
@@ -283,39 +161,24 @@ func (r *RootDirectory) Getattr(
 	return 0
 }
 
-func (r *RootDirectory) Getxattr(
-	ctx context.Context, attr string, dest []byte,
-) (uint32, syscall.Errno) {
-	// Handle common macOS/Netatalk xattrs
-	switch attr {
-	case "user.org.netatalk.Metadata":
-		fallthrough
-	case "com.apple.FinderInfo":
-		fallthrough
-	case "com.apple.ResourceFork":
-		// Return empty data
-		if len(dest) > 0 {
-			return 0, 0
-		}
-
-		return 0, 0
-	default:
-		return 0, syscall.ENODATA
-	}
+func (r *RootDirectory) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	return r.f.getXattr(r.f.sourceDir, attr, dest)
 }
 
 func (r *RootDirectory) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
-	// Silently accept xattr writes (ignore them)
-	return 0
+	return r.f.setXattr(r.f.sourceDir, attr, data, flags)
 }
 
 func (r *RootDirectory) Removexattr(ctx context.Context, attr string) syscall.Errno {
-	return 0
+	return r.f.removeXattr(r.f.sourceDir, attr)
 }
 
 func (r *RootDirectory) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
-	// Return empty xattr list
-	return 0, 0
+	return r.f.listXattrs(r.f.sourceDir, dest)
+}
+
+func (r *RootDirectory) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return r.f.statfs(out)
 }
 
 func (f *FS) NewRootDirectory() *RootDirectory {
@@ -323,3 +186,59 @@ func (f *FS) NewRootDirectory() *RootDirectory {
 		f: f,
 	}
 }
+
+// Only client metadata can be changed, the library content is read-only.
+
+func (r *RootDirectory) metadataChildPath(name string) (string, bool) {
+	if name == searchDirName && r.f.searchTemplate != nil {
+		return r.f.metadataPath(r.f.sourceDir, name), false
+	}
+
+	if r.f.layoutTemplate != nil {
+		return r.f.layoutMetadataChildPath("", name)
+	}
+
+	if r.f.isView(name) {
+		return r.f.metadataPath(r.f.sourceDir, name), false
+	}
+
+	return r.f.metadataPath(r.f.sourceDir, name), r.f.isClientMetadata(r.f.sourceDir, name)
+}
+
+func (r *RootDirectory) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	metaPath, ok := r.metadataChildPath(name)
+	if !ok {
+		return nil, syscall.EPERM
+	}
+
+	return r.f.mkdirMetadata(ctx, &r.Inode, metaPath, mode, out)
+}
+
+func (r *RootDirectory) Rmdir(ctx context.Context, name string) syscall.Errno {
+	metaPath, ok := r.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return r.f.removeMetadata(metaPath, true)
+}
+
+func (r *RootDirectory) Unlink(ctx context.Context, name string) syscall.Errno {
+	metaPath, ok := r.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return r.f.removeMetadata(metaPath, false)
+}
+
+func (r *RootDirectory) Rename(
+	ctx context.Context, name string, newParent fs.InodeEmbedder, newName string, flags uint32,
+) syscall.Errno {
+	metaPath, ok := r.metadataChildPath(name)
+	if !ok {
+		return syscall.EPERM
+	}
+
+	return r.f.renameMetadata(metaPath, newParent, newName, flags)
+}
@@ -0,0 +1,99 @@
+package filesystem
+
+import (
+	"fmt"
+	"hash/fnv"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+)
+
+const (
+	// maxShortenedExtension is the longest extension kept in the shortened
+	// names, longer ones are considered a part of the name.
+	maxShortenedExtension = 8
+	nameHashSeparator     = "~"
+)
+
+// windowsReservedNames are the device names Windows doesn't allow as file
+// names, with any extension.
+var windowsReservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// sanitizeName replaces the characters Windows can't use in the file names,
+// the trailing dots and spaces, and renames the reserved device names.
+func sanitizeName(name, replacement string) string {
+	var builder strings.Builder
+
+	for _, r := range name {
+		if r < ' ' || strings.ContainsRune(configuration.WindowsIllegalCharacters, r) {
+			builder.WriteString(replacement)
+
+			continue
+		}
+
+		builder.WriteRune(r)
+	}
+
+	name = builder.String()
+
+	trimmed := strings.TrimRight(name, ". ")
+	if trimmed != name {
+		name = trimmed + strings.Repeat(replacement, utf8.RuneCountInString(name)-utf8.RuneCountInString(trimmed))
+	}
+
+	base, _, _ := strings.Cut(name, ".")
+	if _, reserved := windowsReservedNames[strings.ToUpper(strings.TrimRight(base, " "))]; reserved {
+		name = base + replacement + name[len(base):]
+	}
+
+	return name
+}
+
+// shortenName cuts the name to the limit, keeping the extension, and adds
+// the hash of the source name, so the shortened names stay unique and the
+// same across restarts.
+func shortenName(name, sourceName string, limit int) string {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(sourceName))
+	suffix := fmt.Sprintf("%s%08x", nameHashSeparator, hash.Sum32())
+
+	extension := filepath.Ext(name)
+	if nameLength(extension) > maxShortenedExtension {
+		extension = ""
+	}
+
+	keep := max(limit-nameLength(suffix)-nameLength(extension), 1)
+
+	var base strings.Builder
+
+	for _, r := range strings.TrimSuffix(name, extension) {
+		keep -= utf16.RuneLen(r)
+		if keep < 0 {
+			break
+		}
+
+		base.WriteRune(r)
+	}
+
+	return base.String() + suffix + extension
+}
+
+// nameLength returns the name length in UTF-16 code units, the way Windows
+// and macOS clients count it: the characters outside the Basic Multilingual
+// Plane, like emoji, take two.
+func nameLength(name string) int {
+	length := 0
+
+	for _, r := range name {
+		length += utf16.RuneLen(r)
+	}
+
+	return length
+}
@@ -0,0 +1,222 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/query"
+)
+
+const (
+	searchDirName = ".search"
+	// searchTrackName is the template of the track names in the results,
+	// they come from different albums.
+	searchTrackName = "$albumartist - $album - %if{$multidisc,$disc-}%if{$track,$track }$title"
+	// searchMaxCached limits the amount of remembered query results, they
+	// are rebuilt on demand.
+	searchMaxCached = 100
+)
+
+// searchTextFields are matched by the bare words of the queries.
+var searchTextFields = []string{"artist", "albumartist", "album", "title"}
+
+// SearchDir is the .search directory in the mount root. It lists nothing,
+// but every name looked up in it is the query, like
+// "artist:radiohead year:1997", and gets the directory of the matching
+// tracks.
+type SearchDir struct {
+	fs.Inode
+
+	f *FS
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*SearchDir)(nil))
+	_ = (fs.NodeLookuper)((*SearchDir)(nil))
+	_ = (fs.NodeReaddirer)((*SearchDir)(nil))
+	_ = (fs.NodeStatfser)((*SearchDir)(nil))
+)
+
+func (d *SearchDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	d.f.fillSearchDirAttr(d.StableAttr().Ino, &out.Attr)
+
+	return 0
+}
+
+func (d *SearchDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	// Clients look for their metadata files everywhere, these aren't queries.
+	if strings.HasPrefix(name, ".") || d.f.metadataRules.match(name) {
+		return nil, syscall.ENOENT
+	}
+
+	q, err := query.Parse(name, searchTextFields)
+	if err != nil {
+		d.f.app.Logger().WithError(err).WithField("query", name).Debug("Invalid search query")
+
+		return nil, syscall.ENOENT
+	}
+
+	results := d.f.searchResults(q)
+
+	// The queries are endless, so the results don't get the persistent
+	// inode numbers.
+	ch := d.NewInode(ctx, &SearchResultsDir{f: d.f, query: q}, fs.StableAttr{Mode: fuse.S_IFDIR})
+	d.f.fillLayoutDirAttr(results, results.root, ch.StableAttr().Ino, &out.Attr)
+
+	return ch, 0
+}
+
+func (d *SearchDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	return fs.NewListDirStream([]fuse.DirEntry{
+		{Name: ".", Mode: d.f.dirMode(0o755), Ino: d.StableAttr().Ino},
+		{Name: "..", Mode: d.f.dirMode(0o755), Ino: 1},
+	}), 0
+}
+
+func (d *SearchDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.f.statfs(out)
+}
+
+func (f *FS) NewSearchDirectory() *SearchDir {
+	return &SearchDir{
+		f: f,
+	}
+}
+
+// SearchResultsDir is the read-only directory of the tracks matching the
+// query. The tracks are the same files as in the main tree.
+type SearchResultsDir struct {
+	fs.Inode
+
+	f     *FS
+	query *query.Query
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*SearchResultsDir)(nil))
+	_ = (fs.NodeLookuper)((*SearchResultsDir)(nil))
+	_ = (fs.NodeReaddirer)((*SearchResultsDir)(nil))
+	_ = (fs.NodeStatfser)((*SearchResultsDir)(nil))
+)
+
+func (d *SearchResultsDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	results := d.f.searchResults(d.query)
+	d.f.fillLayoutDirAttr(results, results.root, d.StableAttr().Ino, &out.Attr)
+
+	return 0
+}
+
+func (d *SearchResultsDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	results := d.f.searchResults(d.query)
+
+	existing, ok := results.root.resolve(d.f, name)
+	if !ok {
+		return nil, syscall.ENOENT
+	}
+
+	return d.f.lookupLayoutFile(ctx, &d.Inode, results, results.root, existing, out)
+}
+
+func (d *SearchResultsDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	dirEntries := []fuse.DirEntry{
+		{Name: ".", Mode: d.f.dirMode(0o755), Ino: d.StableAttr().Ino},
+		{Name: "..", Mode: d.f.dirMode(0o755), Ino: nodeParentInode(&d.Inode)},
+	}
+
+	return fs.NewListDirStream(append(dirEntries, d.f.listLayoutDir(d.f.searchResults(d.query).root)...)), 0
+}
+
+func (d *SearchResultsDir) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return d.f.statfs(out)
+}
+
+// searchKey is the key of the .search directory in the inode table.
+func (f *FS) searchKey() string {
+	return "search:/"
+}
+
+// searchResults returns the tracks matching the query in the current library
+// index, as the flat layout tree.
+func (f *FS) searchResults(q *query.Query) *layoutTree {
+	tracks, version := f.library.Tracks()
+
+	f.searchesMutex.Lock()
+	results, ok := f.searches[q.String()]
+	f.searchesMutex.Unlock()
+
+	if ok && results.version == version {
+		return results
+	}
+
+	results = f.buildSearchResults(q, tracks, version)
+
+	f.searchesMutex.Lock()
+	defer f.searchesMutex.Unlock()
+
+	if len(f.searches) >= searchMaxCached {
+		clear(f.searches)
+	}
+
+	f.searches[q.String()] = results
+
+	return results
+}
+
+func (f *FS) buildSearchResults(q *query.Query, tracks []*dto.Track, version uint64) *layoutTree {
+	started := time.Now()
+	dirPath := filepath.Join(searchDirName, q.String())
+	dir := newLayoutDir(dirPath, nameLength(dirPath)+1, true)
+	matched := 0
+
+	for _, track := range tracks {
+		fields := &trackFields{f: f, track: track}
+		if !q.Match(fields) {
+			continue
+		}
+
+		matched++
+		if matched > f.searchConfig.MaxResults {
+			continue
+		}
+
+		_, _ = f.placeTrack(dir, f.searchTemplate, fields)
+	}
+
+	// The results are the tracks only, the covers of the different albums
+	// would collide.
+	clear(dir.sourceDirs)
+	dir.finish(f)
+
+	f.app.Logger().WithFields(logrus.Fields{
+		"query":    q.String(),
+		"matched":  matched,
+		"shown":    len(dir.files),
+		"duration": time.Since(started),
+	}).Debug("Searched library")
+
+	return &layoutTree{version: version, built: time.Now(), root: dir}
+}
+
+func (f *FS) fillSearchDirAttr(ino uint64, out *fuse.Attr) {
+	out.Mode = f.dirMode(0o755)
+	out.Nlink = 2
+	out.Ino = ino
+	out.Size = 4096
+
+	if info, err := os.Stat(f.sourceDir); err == nil {
+		out.Mtime = uint64(info.ModTime().Unix())
+	}
+
+	out.Atime = out.Mtime
+	out.Ctime = out.Mtime
+	out.Blocks = 1
+	out.Blksize = 512
+}
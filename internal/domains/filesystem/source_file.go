@@ -0,0 +1,115 @@
+package filesystem
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// SourceFile is a non-FLAC source file, like cover art, a booklet or an
+// already compatible track, served straight from the source library.
+type SourceFile struct {
+	fs.Inode
+
+	f    *FS
+	path string
+}
+
+var (
+	_ = (fs.NodeGetattrer)((*SourceFile)(nil))
+	_ = (fs.NodeGetxattrer)((*SourceFile)(nil))
+	_ = (fs.NodeSetxattrer)((*SourceFile)(nil))
+	_ = (fs.NodeRemovexattrer)((*SourceFile)(nil))
+	_ = (fs.NodeListxattrer)((*SourceFile)(nil))
+	_ = (fs.NodeStatfser)((*SourceFile)(nil))
+	_ = (fs.NodeOpener)((*SourceFile)(nil))
+)
+
+func (s *SourceFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return syscall.ENOENT
+	}
+
+	s.f.fillSourceFileAttr(info, s.StableAttr().Ino, &out.Attr)
+
+	return 0
+}
+
+func (s *SourceFile) Open(ctx context.Context, flags uint32) (fh fs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
+	if flags&fuse.O_ANYWRITE != 0 {
+		return nil, 0, syscall.EPERM
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, 0, syscall.EIO
+	}
+
+	return s.f.NewBackingFile(file), fuse.FOPEN_KEEP_CACHE, 0
+}
+
+func (s *SourceFile) Getxattr(ctx context.Context, attr string, dest []byte) (uint32, syscall.Errno) {
+	return s.f.getXattr(s.path, attr, dest)
+}
+
+func (s *SourceFile) Setxattr(ctx context.Context, attr string, data []byte, flags uint32) syscall.Errno {
+	return s.f.setXattr(s.path, attr, data, flags)
+}
+
+func (s *SourceFile) Removexattr(ctx context.Context, attr string) syscall.Errno {
+	return s.f.removeXattr(s.path, attr)
+}
+
+func (s *SourceFile) Listxattr(ctx context.Context, dest []byte) (uint32, syscall.Errno) {
+	return s.f.listXattrs(s.path, dest)
+}
+
+func (s *SourceFile) Statfs(ctx context.Context, out *fuse.StatfsOut) syscall.Errno {
+	return s.f.statfs(out)
+}
+
+func (f *FS) fillSourceFileAttr(info os.FileInfo, ino uint64, out *fuse.Attr) {
+	out.Mode = f.fileMode(0o444)
+	out.Nlink = 1
+	out.Ino = ino
+	out.Size = uint64(info.Size())
+	out.Mtime = uint64(info.ModTime().Unix())
+	out.Atime = out.Mtime
+	out.Ctime = out.Mtime
+	out.Blocks = (out.Size + 511) / 512
+}
+
+// isHiddenSourceFile returns true for the entries of the source directory
+// that are neither directories, transcoded FLACs nor served as is.
+func (f *FS) isHiddenSourceFile(sourceDir string, entry os.DirEntry) bool {
+	name := entry.Name()
+
+	return !isSourceDir(sourceDir, entry) &&
+		!strings.HasSuffix(strings.ToLower(name), ".flac") &&
+		!f.passthrough.Exposed(name)
+}
+
+// isSourceDir reports whether the entry of the source directory is a
+// directory. The symlinks are followed, like on lookup.
+func isSourceDir(sourceDir string, entry os.DirEntry) bool {
+	if entry.Type()&os.ModeSymlink == 0 {
+		return entry.IsDir()
+	}
+
+	info, err := os.Stat(filepath.Join(sourceDir, entry.Name()))
+
+	return err == nil && info.IsDir()
+}
+
+func (f *FS) NewSourceFile(path string) *SourceFile {
+	return &SourceFile{
+		f:    f,
+		path: path,
+	}
+}
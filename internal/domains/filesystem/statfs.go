@@ -0,0 +1,148 @@
+package filesystem
+
+import (
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/filesystem/models"
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
+)
+
+const (
+	statfsBlockSize    = 4096
+	statfsNameLength   = 255
+	libraryStatsCheck  = time.Minute
+	libraryStatsMaxAge = time.Hour
+)
+
+// statfs reports the virtual library size as the used space, and the free
+// space of the volume holding the cache and the client metadata, since that's
+// where the clients' writes and the transcodes go.
+func (f *FS) statfs(out *fuse.StatfsOut) syscall.Errno {
+	var st unix.Statfs_t
+
+	err := unix.Statfs(f.metadataDir, &st)
+	if err != nil {
+		return syscall.EIO
+	}
+
+	var stats models.LibraryStats
+	if current := f.libraryStats.Load(); current != nil {
+		stats = *current
+	}
+
+	volumeBlockSize := uint64(st.Bsize)
+	freeBlocks := st.Bfree * volumeBlockSize / statfsBlockSize
+	usedBlocks := (stats.Size + statfsBlockSize - 1) / statfsBlockSize
+
+	out.Bsize = statfsBlockSize
+	out.Frsize = statfsBlockSize
+	out.NameLen = statfsNameLength
+	out.Blocks = usedBlocks + freeBlocks
+	out.Bfree = freeBlocks
+	out.Bavail = st.Bavail * volumeBlockSize / statfsBlockSize
+	out.Files = stats.Files + st.Ffree
+	out.Ffree = st.Ffree
+
+	return 0
+}
+
+// refreshLibraryStats recalculates the library size when the source library
+// was changed or the numbers are too old, until the application is stopped.
+func (f *FS) refreshLibraryStats() {
+	f.updateLibraryStats()
+
+	ticker := time.NewTicker(libraryStatsCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.app.Context().Done():
+			return
+		case <-ticker.C:
+			stats := f.libraryStats.Load()
+			if f.libraryStatsDirty.Load() || stats == nil || time.Since(stats.Updated) > libraryStatsMaxAge {
+				f.updateLibraryStats()
+			}
+		}
+	}
+}
+
+// estimatedSize returns the size of the virtual file backed by the source
+// file. ALAC is about as large as FLAC, so the source size is used for it.
+// AAC size follows the bitrate and the track duration.
+func (f *FS) estimatedSize(sourcePath string, info fs.FileInfo) uint64 {
+	if f.profile.Codec != configuration.CodecAAC || !strings.HasSuffix(strings.ToLower(sourcePath), ".flac") {
+		return uint64(info.Size())
+	}
+
+	streamInfo, err := flac.ReadStreamInfo(sourcePath)
+	if err != nil || streamInfo.Duration() == 0 {
+		return uint64(info.Size())
+	}
+
+	return uint64(streamInfo.Duration().Seconds() * float64(f.profile.BitsPerSecond()) / 8)
+}
+
+// updateLibraryStats walks the source library and the metadata store and
+// sums up the sizes of the virtual files. The track sizes are estimated for
+// the active profile, asking the cacher would flood its stat cache with the
+// whole library.
+func (f *FS) updateLibraryStats() {
+	f.libraryStatsDirty.Store(false)
+
+	started := time.Now()
+	stats := &models.LibraryStats{}
+
+	_ = filepath.WalkDir(f.sourceDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == f.sourceDir {
+			return nil
+		}
+
+		if strings.HasPrefix(entry.Name(), ".") || f.isHiddenSourceFile(filepath.Dir(path), entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		stats.Files++
+
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			stats.Size += f.estimatedSize(path, info)
+		}
+
+		return nil
+	})
+
+	_ = filepath.WalkDir(f.metadataDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == f.metadataDir {
+			return nil
+		}
+
+		stats.Files++
+
+		if info, err := entry.Info(); err == nil && !entry.IsDir() {
+			stats.Size += uint64(info.Size())
+		}
+
+		return nil
+	})
+
+	stats.Updated = time.Now()
+	f.libraryStats.Store(stats)
+
+	f.app.Logger().WithFields(logrus.Fields{
+		"size":     stats.Size,
+		"files":    stats.Files,
+		"duration": time.Since(started),
+	}).Debug("Updated library size")
+}
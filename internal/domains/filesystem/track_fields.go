@@ -0,0 +1,175 @@
+package filesystem
+
+import (
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+)
+
+// trackFields provides the track tags to the path templates and the search
+// queries. The common fields have fallbacks, so the templates don't produce
+// empty names, and the rest are taken from the tags as is. The overrides
+// replace the fields, like the single genre of the track placed under each
+// of its genres.
+type trackFields struct {
+	f           *FS
+	track       *dto.Track
+	albumUnique string
+	albumAdded  time.Time
+	overrides   map[string]string
+}
+
+func (t *trackFields) AlbumUnique() string {
+	return t.albumUnique
+}
+
+func (t *trackFields) Field(name string) string {
+	value := strings.TrimSpace(t.rawField(name))
+
+	// Tag values can't create directories.
+	return strings.ReplaceAll(value, "/", t.f.names.Replacement)
+}
+
+// Values provides the fields to the search queries: the field with the
+// fallbacks, and every value of the tag with the same name.
+func (t *trackFields) Values(name string) []string {
+	return append([]string{t.rawField(name)}, t.track.Tags.Values(name)...)
+}
+
+func (t *trackFields) rawField(name string) string {
+	if value, ok := t.overrides[name]; ok {
+		return value
+	}
+
+	tags := t.track.Tags
+
+	switch name {
+	case "albumartist":
+		return firstNonEmpty(tags.Get("ALBUMARTIST"), tags.Get("ALBUM ARTIST"), tags.Get("ARTIST"), t.f.layoutConfig.UnknownArtist)
+	case "artist":
+		return firstNonEmpty(tags.Get("ARTIST"), tags.Get("ALBUMARTIST"), t.f.layoutConfig.UnknownArtist)
+	case "album":
+		return firstNonEmpty(tags.Get("ALBUM"), t.f.layoutConfig.Singles)
+	case "title":
+		base := filepath.Base(t.track.SourcePath)
+
+		return firstNonEmpty(tags.Get("TITLE"), strings.TrimSuffix(base, filepath.Ext(base)))
+	case "track":
+		if number, _ := splitNumber(tags.Get("TRACKNUMBER")); number > 0 {
+			return padNumber(number, 2)
+		}
+
+		return ""
+	case "tracktotal":
+		return numberField(t.trackTotal())
+	case "disc":
+		number, _ := splitNumber(tags.Get("DISCNUMBER"))
+		if number == 0 {
+			return ""
+		}
+
+		return padNumber(number, len(strconv.Itoa(t.discTotal())))
+	case "disctotal":
+		return numberField(t.discTotal())
+	case "multidisc":
+		number, _ := splitNumber(tags.Get("DISCNUMBER"))
+		if t.discTotal() > 1 || number > 1 {
+			return "1"
+		}
+
+		return ""
+	case "year":
+		return trackYear(t.track)
+	case "genre":
+		return tags.Get("GENRE")
+	case "added":
+		if t.albumAdded.IsZero() {
+			return t.track.Added.Local().Format(time.DateOnly)
+		}
+
+		return t.albumAdded.Local().Format(time.DateOnly)
+	default:
+		return tags.Get(name)
+	}
+}
+
+func (t *trackFields) trackTotal() int {
+	_, total := splitNumber(t.track.Tags.Get("TRACKNUMBER"))
+
+	return firstPositive(atoi(t.track.Tags.Get("TRACKTOTAL")), atoi(t.track.Tags.Get("TOTALTRACKS")), total)
+}
+
+func (t *trackFields) discTotal() int {
+	_, total := splitNumber(t.track.Tags.Get("DISCNUMBER"))
+
+	return firstPositive(atoi(t.track.Tags.Get("DISCTOTAL")), atoi(t.track.Tags.Get("TOTALDISCS")), total)
+}
+
+// trackYear returns the year from the date tags, which are usually either
+// the year or the full date.
+func trackYear(track *dto.Track) string {
+	for _, field := range []string{"DATE", "YEAR", "ORIGINALDATE"} {
+		value := strings.TrimSpace(track.Tags.Get(field))
+		if len(value) >= 4 && atoi(value[:4]) > 0 {
+			return value[:4]
+		}
+	}
+
+	return ""
+}
+
+// splitNumber parses the "3" and "3/12" forms of the track and disc numbers.
+func splitNumber(value string) (int, int) {
+	number, total, _ := strings.Cut(value, "/")
+
+	return atoi(number), atoi(total)
+}
+
+func atoi(value string) int {
+	number, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || number < 0 {
+		return 0
+	}
+
+	return number
+}
+
+func padNumber(number, width int) string {
+	value := strconv.Itoa(number)
+	if len(value) < width {
+		value = strings.Repeat("0", width-len(value)) + value
+	}
+
+	return value
+}
+
+func numberField(number int) string {
+	if number == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(number)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if strings.TrimSpace(value) != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+func firstPositive(values ...int) int {
+	for _, value := range values {
+		if value > 0 {
+			return value
+		}
+	}
+
+	return 0
+}
@@ -0,0 +1,104 @@
+package filesystem
+
+import (
+	"fmt"
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+	"source.hodakov.me/hdkv/faketunes/internal/pathtemplate"
+)
+
+// layoutView is the read-only top-level directory with the library grouped
+// by the tags. The tracks are the same files as in the main tree.
+type layoutView struct {
+	name     string
+	template *pathtemplate.Template
+	// multiValued is the field the track is placed under each value of.
+	multiValued string
+	// recentDays limits the view to the recently added albums if set.
+	recentDays int
+}
+
+type layoutViews []*layoutView
+
+func (v layoutViews) hasRecent() bool {
+	for _, view := range v {
+		if view.recentDays > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newLayoutViews prepares the views enabled in the config.
+func newLayoutViews(config configuration.Views) (layoutViews, error) {
+	const trackName = "/%if{$multidisc,$disc-}$track $title"
+
+	candidates := []struct {
+		enabled bool
+		view    layoutView
+		source  string
+	}{
+		{config.ByGenre, layoutView{name: "By Genre", multiValued: "genre"},
+			"%ifdef{genre,$genre,Unknown Genre}/$albumartist/$album%aunique{}"},
+		{config.ByYear, layoutView{name: "By Year"},
+			"%ifdef{year,$year,Unknown Year}/$albumartist - $album%aunique{}"},
+		{config.ByArtist, layoutView{name: "By Artist"},
+			"$artist/$album%aunique{}"},
+		{config.RecentlyAdded, layoutView{name: "Recently Added", recentDays: config.RecentDays},
+			"$added $albumartist - $album%aunique{}"},
+	}
+
+	views := make(layoutViews, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		if !candidate.enabled {
+			continue
+		}
+
+		template, err := pathtemplate.Parse(candidate.source + trackName)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w (view %q: %w)", ErrFilesystem, ErrInvalidLayout, candidate.view.name, err)
+		}
+
+		view := candidate.view
+		view.template = template
+		views = append(views, &view)
+	}
+
+	return views, nil
+}
+
+// placeViewTrack adds the track to the view directory.
+func (f *FS) placeViewTrack(dir *layoutDir, view *layoutView, fields *trackFields, now time.Time) {
+	if view.recentDays > 0 && now.Sub(fields.albumAdded) > time.Duration(view.recentDays)*24*time.Hour {
+		return
+	}
+
+	values := fields.track.Tags.Values(view.multiValued)
+	if view.multiValued == "" || len(values) < 2 {
+		_, _ = f.placeTrack(dir, view.template, fields)
+
+		return
+	}
+
+	seen := make(map[string]struct{}, len(values))
+
+	for _, value := range values {
+		key := f.foldName(value)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+
+		seen[key] = struct{}{}
+
+		_, _ = f.placeTrack(dir, view.template, &trackFields{
+			f:           f,
+			track:       fields.track,
+			albumUnique: fields.albumUnique,
+			albumAdded:  fields.albumAdded,
+			overrides:   map[string]string{view.multiValued: value},
+		})
+	}
+}
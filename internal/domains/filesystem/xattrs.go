@@ -0,0 +1,304 @@
+package filesystem
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/filesystem/models"
+)
+
+const (
+	// xattrSizeMax is the Linux limit for a single attribute value. Samba
+	// keeps the alternate data streams (user.DosStream.*) in attributes, so
+	// it bounds them as well.
+	xattrSizeMax = 64 * 1024
+	// xattrUserPrefix is the only namespace stored: the kernel handles the
+	// others, or they have no meaning for the virtual files.
+	xattrUserPrefix = "user."
+)
+
+// The extended attributes are kept in a small keyed store next to the
+// metadata store: one file per object, keyed by the object's backing path, so
+// they work for the music files and directories as well as for the client
+// metadata. Every change is written to disk at once. The store can't live
+// inside the metadata store, everything there is shown to the clients as
+// their own files.
+
+// loadXattrs reads the extended attributes store.
+func (f *FS) loadXattrs() error {
+	entries, err := os.ReadDir(f.xattrDir)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToLoadXattrs, err)
+	}
+
+	f.xattrsMutex.Lock()
+	defer f.xattrsMutex.Unlock()
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		rawRecord, err := os.ReadFile(filepath.Join(f.xattrDir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrFilesystem, ErrFailedToLoadXattrs, err)
+		}
+
+		record := new(models.XattrRecord)
+
+		err = json.Unmarshal(rawRecord, record)
+		if err != nil {
+			return fmt.Errorf("%w: %w (%s: %w)", ErrFilesystem, ErrFailedToLoadXattrs, entry.Name(), err)
+		}
+
+		f.xattrs[record.Key] = record.Attrs
+	}
+
+	pruned := f.pruneMissingXattrs()
+
+	f.app.Logger().WithFields(logrus.Fields{
+		"entries": len(f.xattrs),
+		"pruned":  pruned,
+	}).Debug("Loaded extended attributes")
+
+	return nil
+}
+
+func (f *FS) getXattr(key, attr string, dest []byte) (uint32, syscall.Errno) {
+	f.xattrsMutex.RLock()
+	defer f.xattrsMutex.RUnlock()
+
+	value, ok := f.xattrs[key][attr]
+	if !ok {
+		return 0, syscall.ENODATA
+	}
+
+	return copyXattrValue(value, dest)
+}
+
+func (f *FS) setXattr(key, attr string, data []byte, flags uint32) syscall.Errno {
+	if !strings.HasPrefix(attr, xattrUserPrefix) {
+		return syscall.ENOTSUP
+	}
+
+	if len(data) > xattrSizeMax {
+		return syscall.E2BIG
+	}
+
+	f.xattrsMutex.Lock()
+	defer f.xattrsMutex.Unlock()
+
+	attrs := f.xattrs[key]
+	_, exists := attrs[attr]
+
+	switch {
+	case flags&unix.XATTR_CREATE != 0 && exists:
+		return syscall.EEXIST
+	case flags&unix.XATTR_REPLACE != 0 && !exists:
+		return syscall.ENODATA
+	}
+
+	if attrs == nil {
+		attrs = make(map[string][]byte, 1)
+		f.xattrs[key] = attrs
+	}
+
+	previous := attrs[attr]
+	attrs[attr] = slices.Clone(data)
+
+	errno := f.saveXattrRecord(key)
+	if errno != 0 {
+		if exists {
+			attrs[attr] = previous
+		} else {
+			delete(attrs, attr)
+		}
+	}
+
+	return errno
+}
+
+func (f *FS) removeXattr(key, attr string) syscall.Errno {
+	f.xattrsMutex.Lock()
+	defer f.xattrsMutex.Unlock()
+
+	if _, ok := f.xattrs[key][attr]; !ok {
+		return syscall.ENODATA
+	}
+
+	delete(f.xattrs[key], attr)
+
+	return f.saveXattrRecord(key)
+}
+
+func (f *FS) listXattrs(key string, dest []byte) (uint32, syscall.Errno) {
+	return copyXattrNames(f.xattrNames(key), dest)
+}
+
+func (f *FS) xattrNames(key string) []string {
+	f.xattrsMutex.RLock()
+	defer f.xattrsMutex.RUnlock()
+
+	return slices.Sorted(maps.Keys(f.xattrs[key]))
+}
+
+// copyXattrValue copies the attribute value to the destination buffer, or
+// reports the required buffer size.
+func copyXattrValue(value, dest []byte) (uint32, syscall.Errno) {
+	if len(dest) < len(value) {
+		return uint32(len(value)), syscall.ERANGE
+	}
+
+	return uint32(copy(dest, value)), 0
+}
+
+// copyXattrNames copies the null terminated attribute names to the
+// destination buffer, or reports the required buffer size.
+func copyXattrNames(attrs []string, dest []byte) (uint32, syscall.Errno) {
+	names := make([]byte, 0)
+	for _, attr := range attrs {
+		names = append(names, attr...)
+		names = append(names, 0)
+	}
+
+	return copyXattrValue(names, dest)
+}
+
+// moveXattrs moves the extended attributes of the renamed object and
+// everything below it. On exchange the two objects swap their attributes,
+// otherwise the attributes of the replaced objects are dropped.
+func (f *FS) moveXattrs(oldKey, newKey string, exchange bool) {
+	f.xattrsMutex.Lock()
+	defer f.xattrsMutex.Unlock()
+
+	// The map can't be added to while ranging over it: the moved keys could
+	// be visited again.
+	moved := make(map[string]map[string][]byte, 0)
+	touched := make([]string, 0)
+
+	for key, attrs := range f.xattrs {
+		movedKey, ok := renamedPath(key, oldKey, newKey)
+		if !ok {
+			movedKey, ok = renamedPath(key, newKey, oldKey)
+			if ok && !exchange {
+				movedKey = ""
+			}
+		}
+
+		if !ok {
+			continue
+		}
+
+		delete(f.xattrs, key)
+		touched = append(touched, key)
+
+		if movedKey != "" {
+			moved[movedKey] = attrs
+			touched = append(touched, movedKey)
+		}
+	}
+
+	maps.Copy(f.xattrs, moved)
+
+	for _, key := range touched {
+		f.logXattrError(f.saveXattrRecord(key), key)
+	}
+}
+
+// dropXattrs forgets the extended attributes of the removed object and
+// everything below it.
+func (f *FS) dropXattrs(key string) {
+	f.xattrsMutex.Lock()
+	defer f.xattrsMutex.Unlock()
+
+	prefix := key + string(filepath.Separator)
+
+	for _, dropped := range slices.Collect(maps.Keys(f.xattrs)) {
+		if dropped == key || strings.HasPrefix(dropped, prefix) {
+			delete(f.xattrs, dropped)
+			f.logXattrError(f.saveXattrRecord(dropped), dropped)
+		}
+	}
+}
+
+// pruneMissingXattrs forgets the attributes of the source files and client
+// metadata removed while faketunes wasn't running. It returns the amount of
+// removed records. Must be called with xattrsMutex held.
+func (f *FS) pruneMissingXattrs() int {
+	pruned := 0
+
+	for _, key := range slices.Collect(maps.Keys(f.xattrs)) {
+		// The layout keys aren't paths on disk.
+		if !filepath.IsAbs(key) {
+			continue
+		}
+
+		if _, err := os.Lstat(key); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		delete(f.xattrs, key)
+		f.logXattrError(f.saveXattrRecord(key), key)
+
+		pruned++
+	}
+
+	return pruned
+}
+
+// saveXattrRecord atomically writes the object's attributes to disk, or
+// removes the record if there are none. Must be called with xattrsMutex held.
+func (f *FS) saveXattrRecord(key string) syscall.Errno {
+	hash := md5.Sum([]byte(key))
+	recordPath := filepath.Join(f.xattrDir, hex.EncodeToString(hash[:])+".json")
+
+	attrs := f.xattrs[key]
+	if len(attrs) == 0 {
+		delete(f.xattrs, key)
+
+		err := os.Remove(recordPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fs.ToErrno(err)
+		}
+
+		return 0
+	}
+
+	rawRecord, err := json.Marshal(&models.XattrRecord{Key: key, Attrs: attrs})
+	if err != nil {
+		return syscall.EIO
+	}
+
+	tmpPath := recordPath + ".tmp"
+
+	err = os.WriteFile(tmpPath, rawRecord, 0o644)
+	if err == nil {
+		err = os.Rename(tmpPath, recordPath)
+	}
+
+	if err != nil {
+		return fs.ToErrno(err)
+	}
+
+	return 0
+}
+
+func (f *FS) logXattrError(errno syscall.Errno, key string) {
+	if errno == 0 {
+		return
+	}
+
+	f.app.Logger().WithField("key", key).WithError(errno).Error("Failed to save extended attributes")
+}
@@ -0,0 +1,10 @@
+package domains
+
+import "source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+
+const LibraryName = "library"
+
+type Library interface {
+	Tracks() ([]*dto.Track, uint64)
+	Invalidate(sourcePath string)
+}
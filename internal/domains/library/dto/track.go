@@ -0,0 +1,16 @@
+package dto
+
+import (
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
+)
+
+// Track is representing the source FLAC file with its tags. Added is the
+// time the track appeared in the library.
+type Track struct {
+	SourcePath string
+	Tags       flac.Tags
+	ModTime    time.Time
+	Added      time.Time
+}
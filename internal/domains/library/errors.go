@@ -0,0 +1,10 @@
+package library
+
+import "errors"
+
+var (
+	ErrLibrary              = errors.New("library")
+	ErrFailedToGetWaitGroup = errors.New("failed to get global waitgroup")
+	ErrFailedToLoadIndex    = errors.New("failed to load library index")
+	ErrFailedToSaveIndex    = errors.New("failed to save library index")
+)
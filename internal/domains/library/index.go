@@ -0,0 +1,280 @@
+package library
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/models"
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
+)
+
+// Tracks returns the indexed tracks sorted by the source path, and the index
+// version. The version changes every time the index is changed.
+func (l *Library) Tracks() ([]*dto.Track, uint64) {
+	l.snapshotMutex.Lock()
+	defer l.snapshotMutex.Unlock()
+
+	version := l.version.Load()
+	if l.snapshot != nil && l.snapshotVersion == version {
+		return l.snapshot, version
+	}
+
+	l.indexMutex.RLock()
+
+	tracks := make([]*dto.Track, 0, len(l.index))
+	for sourcePath, entry := range l.index {
+		tracks = append(tracks, &dto.Track{
+			SourcePath: sourcePath,
+			Tags:       entry.Tags,
+			ModTime:    entry.ModTime,
+			Added:      entry.Added,
+		})
+	}
+
+	l.indexMutex.RUnlock()
+
+	slices.SortFunc(tracks, func(a, b *dto.Track) int {
+		return strings.Compare(a.SourcePath, b.SourcePath)
+	})
+
+	l.snapshot = tracks
+	l.snapshotVersion = version
+
+	return tracks, version
+}
+
+// Invalidate queues the changed source file or directory for reindexing.
+func (l *Library) Invalidate(sourcePath string) {
+	if !l.enabled {
+		return
+	}
+
+	l.pendingMutex.Lock()
+	l.pending[sourcePath] = struct{}{}
+	l.pendingMutex.Unlock()
+}
+
+// maintainIndex brings the index up to date with the source library, then
+// applies the queued changes and periodically rescans the library until the
+// application is stopped.
+func (l *Library) maintainIndex() {
+	l.updateIndex(l.sourceDir)
+
+	updateTicker := time.NewTicker(libraryUpdateInterval)
+	defer updateTicker.Stop()
+
+	rescanTicker := time.NewTicker(libraryRescanInterval)
+	defer rescanTicker.Stop()
+
+	for {
+		select {
+		case <-l.app.Context().Done():
+			return
+		case <-updateTicker.C:
+			l.pendingMutex.Lock()
+			pending := l.pending
+			l.pending = make(map[string]struct{}, 0)
+			l.pendingMutex.Unlock()
+
+			for sourcePath := range pending {
+				l.updateIndex(sourcePath)
+			}
+		case <-rescanTicker.C:
+			l.updateIndex(l.sourceDir)
+		}
+	}
+}
+
+// updateIndex reindexes the source file or everything below the source
+// directory. Tags are read again only for the new and changed files.
+func (l *Library) updateIndex(root string) {
+	started := time.Now()
+
+	l.indexMutex.RLock()
+	firstScan := len(l.index) == 0
+	l.indexMutex.RUnlock()
+
+	found := make(map[string]*models.IndexEntry, 0)
+	changed := 0
+
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+
+		if path != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(strings.ToLower(entry.Name()), ".flac") {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		l.indexMutex.RLock()
+		indexed, ok := l.index[path]
+		l.indexMutex.RUnlock()
+
+		if ok && indexed.Size == info.Size() && indexed.ModTime.Equal(info.ModTime()) {
+			found[path] = indexed
+
+			return nil
+		}
+
+		found[path] = l.indexFile(path, info, indexed, firstScan)
+		changed++
+
+		return nil
+	})
+
+	removed := l.replaceIndexed(root, found)
+
+	if changed == 0 && removed == 0 {
+		return
+	}
+
+	l.version.Add(1)
+
+	err := l.saveIndex()
+	if err != nil {
+		l.app.Logger().WithError(err).Error("Failed to save library index")
+	}
+
+	l.app.Logger().WithFields(logrus.Fields{
+		"path":     root,
+		"changed":  changed,
+		"removed":  removed,
+		"duration": time.Since(started),
+	}).Info("Updated library index")
+}
+
+// indexFile reads the tags of the new or changed source file. On the first
+// scan the files are considered added when they were last modified, later
+// the new files are added now.
+func (l *Library) indexFile(path string, info fs.FileInfo, indexed *models.IndexEntry, firstScan bool) *models.IndexEntry {
+	tags, err := flac.ReadTags(path)
+	if err != nil {
+		l.app.Logger().WithError(err).WithField("source file", path).Warn("Failed to read tags")
+
+		tags = flac.Tags{}
+	}
+
+	entry := &models.IndexEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+		Added:   time.Now(),
+		Tags:    tags,
+	}
+
+	switch {
+	case indexed != nil:
+		entry.Added = indexed.Added
+	case firstScan:
+		entry.Added = info.ModTime()
+	}
+
+	return entry
+}
+
+// replaceIndexed replaces the index entries below the root with the found
+// ones and returns the amount of removed entries.
+func (l *Library) replaceIndexed(root string, found map[string]*models.IndexEntry) int {
+	l.indexMutex.Lock()
+	defer l.indexMutex.Unlock()
+
+	removed := 0
+	prefix := root + string(filepath.Separator)
+
+	for path := range l.index {
+		if path != root && !strings.HasPrefix(path, prefix) {
+			continue
+		}
+
+		if _, ok := found[path]; !ok {
+			delete(l.index, path)
+			removed++
+		}
+	}
+
+	for path, entry := range found {
+		l.index[path] = entry
+	}
+
+	return removed
+}
+
+// loadIndex reads the persistent library index.
+func (l *Library) loadIndex() error {
+	rawIndex, err := os.ReadFile(l.indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrLibrary, ErrFailedToLoadIndex, err)
+	}
+
+	index := make(map[string]*models.IndexEntry, 0)
+
+	err = json.Unmarshal(rawIndex, &index)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrLibrary, ErrFailedToLoadIndex, err)
+	}
+
+	l.indexMutex.Lock()
+	l.index = index
+	l.indexMutex.Unlock()
+
+	l.version.Add(1)
+
+	l.app.Logger().WithField("entries", len(index)).Debug("Loaded library index")
+
+	return nil
+}
+
+// saveIndex atomically writes the library index to disk.
+func (l *Library) saveIndex() error {
+	l.indexMutex.RLock()
+	rawIndex, err := json.Marshal(l.index)
+	l.indexMutex.RUnlock()
+
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrLibrary, ErrFailedToSaveIndex, err)
+	}
+
+	err = os.MkdirAll(filepath.Dir(l.indexPath), 0o755)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrLibrary, ErrFailedToSaveIndex, err)
+	}
+
+	tmpPath := l.indexPath + ".tmp"
+
+	err = os.WriteFile(tmpPath, rawIndex, 0o644)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrLibrary, ErrFailedToSaveIndex, err)
+	}
+
+	err = os.Rename(tmpPath, l.indexPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrLibrary, ErrFailedToSaveIndex, err)
+	}
+
+	return nil
+}
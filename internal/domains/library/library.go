@@ -0,0 +1,87 @@
+package library
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/application"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+	"source.hodakov.me/hdkv/faketunes/internal/domains"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/domains/library/models"
+)
+
+const (
+	libraryUpdateInterval = 2 * time.Second
+	libraryRescanInterval = time.Hour
+)
+
+var (
+	_ domains.Library = new(Library)
+	_ domains.Domain  = new(Library)
+)
+
+// Library keeps the index of the source FLACs with their tags, for the
+// virtual layouts, views, searches and playlists which don't follow the
+// source directory structure. It's only built if some of them needs it.
+type Library struct {
+	app *application.App
+
+	sourceDir string
+	indexPath string
+	enabled   bool
+
+	index      map[string]*models.IndexEntry
+	indexMutex sync.RWMutex
+	version    atomic.Uint64
+
+	snapshot        []*dto.Track
+	snapshotVersion uint64
+	snapshotMutex   sync.Mutex
+
+	pending      map[string]struct{}
+	pendingMutex sync.Mutex
+}
+
+func New(app *application.App) *Library {
+	return &Library{
+		app:       app,
+		sourceDir: app.Config().Paths.Source,
+		indexPath: app.Config().Paths.Destination + "/.state/library.json",
+		enabled:   libraryNeeded(app.Config()),
+		index:     make(map[string]*models.IndexEntry, 0),
+		pending:   make(map[string]struct{}, 0),
+	}
+}
+
+func libraryNeeded(config *configuration.Config) bool {
+	return config.Layout.Enabled() || config.Views.Enabled() || config.Search.Enabled || len(config.Playlists) > 0
+}
+
+func (l *Library) ConnectDependencies() error {
+	return nil
+}
+
+func (l *Library) Start() error {
+	if !l.enabled {
+		return nil
+	}
+
+	err := l.loadIndex()
+	if err != nil {
+		return err
+	}
+
+	wg := l.app.GetGlobalWaitGroup()
+	if wg == nil {
+		return fmt.Errorf("%w: %w (%s)", ErrLibrary, ErrFailedToGetWaitGroup, "got nil waitgroup")
+	}
+
+	wg.Go(func() {
+		l.maintainIndex()
+	})
+
+	return nil
+}
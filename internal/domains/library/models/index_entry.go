@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
+)
+
+// IndexEntry is representing the indexed source FLAC file. Size and ModTime
+// are used to tell if the tags must be read again.
+type IndexEntry struct {
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	Added   time.Time `json:"added"`
+	Tags    flac.Tags `json:"tags"`
+}
@@ -1,8 +1,12 @@
 package domains
 
+import "source.hodakov.me/hdkv/faketunes/internal/domains/transcoder/dto"
+
 const TranscoderName = "transcoder"
 
 type Transcoder interface {
 	Convert(sourcePath, destinationPath string) (int64, error)
+	CheckSource(sourcePath string) (*dto.SourceCheck, error)
+	ProfileKey() string
 	QueueChannel() chan struct{}
 }
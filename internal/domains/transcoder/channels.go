@@ -0,0 +1,40 @@
+package transcoder
+
+import (
+	"fmt"
+	"math"
+
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+)
+
+// channelFilter returns the filter converting the source channels into the
+// layout playable by the iPod, or an empty string if no conversion is needed.
+func (t *Transcoder) channelFilter(channels int) string {
+	switch {
+	case channels == 1 && t.profile.Downmix.Mono == configuration.MonoStereo:
+		// Pure channel mapping, keeps the samples intact.
+		return "pan=stereo|c0=c0|c1=c0"
+	case channels > 2:
+		return t.downmixFilter()
+	default:
+		return ""
+	}
+}
+
+// downmixFilter returns the filter mixing multichannel audio into stereo.
+func (t *Transcoder) downmixFilter() string {
+	downmix := t.profile.Downmix
+
+	if downmix.Left != "" && downmix.Right != "" {
+		return "pan=stereo|FL=" + downmix.Left + "|FR=" + downmix.Right
+	}
+
+	// swresample knows the channel layouts, so the levels are applied to
+	// whichever center, surround and LFE channels the source has.
+	centerLevel := *downmix.Center * math.Pow(10, downmix.DialogueBoost/20)
+
+	return fmt.Sprintf(
+		"aresample=ocl=stereo:clev=%g:slev=%g:lfe_mix_level=%g",
+		centerLevel, *downmix.Surround, downmix.LFE,
+	)
+}
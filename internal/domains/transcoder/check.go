@@ -0,0 +1,62 @@
+package transcoder
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"source.hodakov.me/hdkv/faketunes/internal/domains/transcoder/dto"
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
+)
+
+// CheckSource decodes the whole source FLAC file and checks it for damaged
+// frames, truncation and STREAMINFO MD5 mismatch. The returned error is only
+// set if the check itself failed, not when the file is corrupt.
+func (t *Transcoder) CheckSource(sourcePath string) (*dto.SourceCheck, error) {
+	streamInfo, err := flac.ReadStreamInfo(sourcePath)
+	if err != nil {
+		return &dto.SourceCheck{
+			Corrupt: true,
+			Reason:  err.Error(),
+		}, nil
+	}
+
+	digest, err := t.decodePCM(sourcePath, streamInfo.BitsPerSample, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrSourceCheckFailed, err)
+	}
+
+	if digest.DecodeErrors != "" {
+		return &dto.SourceCheck{
+			Corrupt: true,
+			Reason:  "decoder errors: " + digest.DecodeErrors,
+		}, nil
+	}
+
+	bytesPerFrame := int64((streamInfo.BitsPerSample+7)/8) * int64(streamInfo.Channels)
+	decodedSamples := uint64(digest.Bytes / bytesPerFrame)
+
+	// Total samples count is optional in STREAMINFO.
+	if streamInfo.TotalSamples > 0 && decodedSamples != streamInfo.TotalSamples {
+		return &dto.SourceCheck{
+			Corrupt: true,
+			Reason: fmt.Sprintf(
+				"truncated: decoded %d samples of %d declared in STREAMINFO",
+				decodedSamples, streamInfo.TotalSamples,
+			),
+		}, nil
+	}
+
+	if streamInfo.HasMD5() && streamInfo.BitsPerSample%8 == 0 {
+		expectedMD5 := hex.EncodeToString(streamInfo.MD5[:])
+		if expectedMD5 != digest.MD5 {
+			return &dto.SourceCheck{
+				Corrupt: true,
+				Reason: fmt.Sprintf(
+					"STREAMINFO MD5 mismatch: expected %s, got %s", expectedMD5, digest.MD5,
+				),
+			}, nil
+		}
+	}
+
+	return &dto.SourceCheck{}, nil
+}
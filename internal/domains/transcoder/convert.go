@@ -6,18 +6,19 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 
 	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
 )
 
+// Source parameters assumed if ffprobe fails.
 const (
 	defaultSampleRate = 48000
 	defaultBitDepth   = 16
 )
 
-// Convert converts the file from FLAC to ALAC using ffmpeg.
+// Convert converts the FLAC file using ffmpeg into the format of the active profile.
 // It embeds all required metadata and places the file in the desired destination.
 // On success, it returns the transcoded file's size.
 func (t *Transcoder) Convert(sourcePath, destinationPath string) (int64, error) {
@@ -41,45 +42,20 @@ func (t *Transcoder) Convert(sourcePath, destinationPath string) (int64, error)
 		"Setting sorting artist for iTunes",
 	)
 
-	sourceAnalyzeCmd := exec.Command(
-		"ffprobe",
-		"-v", "quiet",
-		"-show_streams",
-		"-select_streams", "a:0",
-		"-of", "csv=p=0",
-		sourcePath,
-	)
-
-	analyzeOutput, err := sourceAnalyzeCmd.Output()
-	if err == nil {
-		// Investigate bit depth and sample rate from ffprobe output.
+	sourceInfo, err := t.probe(sourcePath)
+	if err != nil {
+		t.app.Logger().WithError(err).WithField("source file", sourcePath).Warn(
+			"Failed to probe source file, assuming default sample rate and bit depth",
+		)
+	} else {
 		// We need that to make sure we don't oversample files that are lower
 		// than the default sample rate and bit depth.
-		lines := strings.SplitSeq(strings.TrimSpace(string(analyzeOutput)), "\n")
-		for line := range lines {
-			if strings.Contains(line, "audio") {
-				parts := strings.Split(line, ",")
-				if len(parts) >= 6 {
-					// Get sample rate
-					if sr, err := strconv.Atoi(parts[2]); err == nil && sr > 0 {
-						sampleRate = sr
-					}
-
-					// Get bit depth from sample_fmt or bits_per_raw_sample
-					sampleFmt := parts[4]
-					if strings.Contains(sampleFmt, "s32") || strings.Contains(sampleFmt, "flt") {
-						bitDepth = 32
-					} else if strings.Contains(sampleFmt, "s64") || strings.Contains(sampleFmt, "dbl") {
-						bitDepth = 64
-					} else if len(parts) >= 6 && parts[5] != "N/A" && parts[5] != "" {
-						if bd, err := strconv.Atoi(parts[5]); err == nil && bd > 0 {
-							bitDepth = bd
-						}
-					}
-				}
-
-				break // We only need the first audio stream
-			}
+		if sourceInfo.SampleRate > 0 {
+			sampleRate = sourceInfo.SampleRate
+		}
+
+		if sourceInfo.BitDepth > 0 {
+			bitDepth = sourceInfo.BitDepth
 		}
 	}
 
@@ -88,19 +64,39 @@ func (t *Transcoder) Convert(sourcePath, destinationPath string) (int64, error)
 		"sample rate": sampleRate,
 	}).Info("Detected source file sample rate and bit depth")
 
-	needsDownsample := sampleRate > defaultSampleRate
-	needsBitReduce := bitDepth > defaultBitDepth
+	targetSampleRate := t.targetSampleRate(sampleRate)
+	targetBitDepth := t.targetBitDepth(bitDepth)
+	needsResample := targetSampleRate != sampleRate
+	needsBitReduce := targetBitDepth != bitDepth
+	channelFilter := ""
 
-	if needsDownsample {
+	if sourceInfo != nil {
+		channelFilter = t.channelFilter(sourceInfo.Channels)
+	}
+
+	if channelFilter != "" {
 		t.app.Logger().WithFields(logrus.Fields{
-			"new sample rate": defaultSampleRate,
+			"channels":       sourceInfo.Channels,
+			"channel layout": sourceInfo.ChannelLayout,
+		}).Info("Channel layout of the destination file will be changed")
+	}
+
+	hasFilters := len(t.profile.Filters) > 0
+	// Filters and downmix produce floating point samples, which have to be
+	// dithered back into the integer ALAC samples.
+	isMixed := hasFilters || (channelFilter != "" && sourceInfo.Channels > 2)
+	needsRequantize := needsBitReduce || (isMixed && t.profile.Codec == configuration.CodecALAC)
+
+	if needsResample {
+		t.app.Logger().WithFields(logrus.Fields{
+			"new sample rate": targetSampleRate,
 			"old sample rate": sampleRate,
 		}).Info("Sample rate of the destination file will be changed")
 	}
 
 	if needsBitReduce {
 		t.app.Logger().WithFields(logrus.Fields{
-			"new bit depth": defaultBitDepth,
+			"new bit depth": targetBitDepth,
 			"old bit depth": bitDepth,
 		}).Info("Bit depth of the destination file will be changed")
 	}
@@ -119,32 +115,25 @@ func (t *Transcoder) Convert(sourcePath, destinationPath string) (int64, error)
 		ffmpegArgs = append(ffmpegArgs,
 			"-map", "0:a", // Map audio from first input
 			"-map", "1", // Map image from second input
-			"-c:a", "alac", // ALAC codec for audio
+		)
+		ffmpegArgs = append(ffmpegArgs, t.codecArgs()...)
+		ffmpegArgs = append(ffmpegArgs,
 			"-c:v", "copy", // Copy image without re-encoding
 			"-disposition:v", "attached_pic",
 		)
 	} else {
-		ffmpegArgs = append(ffmpegArgs,
-			"-map", "0:a",
-			"-c:a", "alac",
-		)
+		ffmpegArgs = append(ffmpegArgs, "-map", "0:a")
+		ffmpegArgs = append(ffmpegArgs, t.codecArgs()...)
 	}
 
-	// Handle downsampling
-	if needsDownsample {
+	// Handle channel conversion, user filters, resampling and bit depth
+	// reduction with the profile's DSP policy
+	if channelFilter != "" || hasFilters || needsResample || needsRequantize {
 		ffmpegArgs = append(
 			ffmpegArgs,
-			"-af", "aresample=48000:resampler=soxr:precision=28",
-		)
-	} else {
-		ffmpegArgs = append(ffmpegArgs, "-ar", strconv.Itoa(sampleRate))
-	}
-
-	if needsBitReduce {
-		// Reduce to 16-bit with good dithering
-		ffmpegArgs = append(ffmpegArgs,
-			"-sample_fmt", "s16p",
-			"-dither_method", "triangular",
+			"-af", t.filterChain(
+				channelFilter, targetSampleRate, targetBitDepth, needsResample, needsRequantize,
+			),
 		)
 	}
 
@@ -204,6 +193,23 @@ func (t *Transcoder) Convert(sourcePath, destinationPath string) (int64, error)
 		)
 	}
 
+	if t.app.Config().Transcoding.Verify {
+		lossless := t.profile.Codec == configuration.CodecALAC &&
+			channelFilter == "" && !hasFilters && !needsResample && !needsBitReduce
+
+		err = t.verify(sourcePath, destinationPath, lossless)
+		if err != nil {
+			t.app.Logger().WithError(err).WithFields(logrus.Fields{
+				"source file": sourcePath,
+				"destination": destinationPath,
+			}).Error("Transcoded file verification failed, discarding it")
+
+			_ = os.Remove(destinationPath)
+
+			return 0, err
+		}
+	}
+
 	t.app.Logger().WithFields(logrus.Fields{
 		"source file":      sourcePath,
 		"destination":      destinationPath,
@@ -0,0 +1,86 @@
+package transcoder
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"source.hodakov.me/hdkv/faketunes/internal/domains/transcoder/models"
+)
+
+// decodePCM decodes the first audio stream of the file and returns the MD5 of
+// its PCM data, laid out the same way FLAC does for the STREAMINFO signature:
+// interleaved, signed, little-endian samples of the given bit depth.
+// In strict mode, the decoder checks frame CRCs and reports damaged frames in
+// the digest instead of failing.
+func (t *Transcoder) decodePCM(path string, bitDepth int, strict bool) (*models.PCMDigest, error) {
+	var codec, format string
+
+	switch {
+	case bitDepth <= 8:
+		codec, format = "pcm_s8", "s8"
+	case bitDepth <= 16:
+		codec, format = "pcm_s16le", "s16le"
+	case bitDepth <= 24:
+		codec, format = "pcm_s24le", "s24le"
+	default:
+		codec, format = "pcm_s32le", "s32le"
+	}
+
+	ffmpegArgs := []string{"-v", "error"}
+
+	if strict {
+		ffmpegArgs = append(ffmpegArgs, "-err_detect", "crccheck+bitstream+buffer")
+	}
+
+	ffmpegArgs = append(ffmpegArgs,
+		"-i", path,
+		"-map", "0:a:0",
+		"-c:a", codec,
+		"-f", format,
+		"-",
+	)
+
+	ffmpeg := exec.Command("ffmpeg", ffmpegArgs...)
+
+	var stderr bytes.Buffer
+
+	ffmpeg.Stderr = &stderr
+
+	stdout, err := ffmpeg.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrDecodeError, err)
+	}
+
+	err = ffmpeg.Start()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrDecodeError, err)
+	}
+
+	hash := md5.New()
+
+	decodedBytes, copyErr := io.Copy(hash, stdout)
+
+	err = ffmpeg.Wait()
+	if copyErr != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrDecodeError, copyErr)
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil && (!strict || !errors.As(err, &exitErr)) {
+		t.app.Logger().WithField("ffmpeg stderr", stderr.String()).Debug("Got ffmpeg stderr")
+
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrDecodeError, err)
+	}
+
+	return &models.PCMDigest{
+		MD5:          hex.EncodeToString(hash.Sum(nil)),
+		Bytes:        decodedBytes,
+		DecodeErrors: strings.TrimSpace(stderr.String()),
+	}, nil
+}
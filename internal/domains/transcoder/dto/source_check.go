@@ -0,0 +1,7 @@
+package dto
+
+// SourceCheck is representing the integrity check result of a source file.
+type SourceCheck struct {
+	Corrupt bool
+	Reason  string
+}
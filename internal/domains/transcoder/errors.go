@@ -7,4 +7,10 @@ var (
 	ErrTranscodeError           = errors.New("transcode error")
 	ErrTranscodedFileIsTooSmall = errors.New("transcoded file is too small")
 	ErrTranscodedFileNotFound   = errors.New("transcoded file not found")
+	ErrProbeError               = errors.New("probe error")
+	ErrDecodeError              = errors.New("decode error")
+	ErrVerificationFailed       = errors.New("transcoded file verification failed")
+	ErrSourceCheckFailed        = errors.New("source file check failed")
+	ErrInvalidFilterChain       = errors.New("invalid filter chain")
+	ErrInvalidProfile           = errors.New("invalid transcoding profile")
 )
@@ -0,0 +1,10 @@
+package models
+
+// PCMDigest is representing the decoded PCM data of an audio stream.
+type PCMDigest struct {
+	MD5   string
+	Bytes int64
+	// DecodeErrors holds the decoder complaints (CRC mismatches, invalid
+	// frames and so on). It's empty for the healthy streams.
+	DecodeErrors string
+}
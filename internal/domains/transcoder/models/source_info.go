@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// SourceInfo is representing the first audio stream parameters of a source file.
+type SourceInfo struct {
+	SampleRate    int
+	BitDepth      int
+	Channels      int
+	ChannelLayout string
+	Duration      time.Duration
+}
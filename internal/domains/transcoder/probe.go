@@ -0,0 +1,82 @@
+package transcoder
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/domains/transcoder/models"
+)
+
+type ffprobeOutput struct {
+	Streams []struct {
+		SampleFmt        string `json:"sample_fmt"`
+		SampleRate       string `json:"sample_rate"`
+		Channels         int    `json:"channels"`
+		ChannelLayout    string `json:"channel_layout"`
+		BitsPerRawSample string `json:"bits_per_raw_sample"`
+		Duration         string `json:"duration"`
+	} `json:"streams"`
+}
+
+// probe investigates the first audio stream of the file with ffprobe.
+func (t *Transcoder) probe(path string) (*models.SourceInfo, error) {
+	probeCmd := exec.Command(
+		"ffprobe",
+		"-v", "quiet",
+		"-select_streams", "a:0",
+		"-show_entries", "stream=sample_fmt,sample_rate,channels,channel_layout,bits_per_raw_sample,duration",
+		"-of", "json",
+		path,
+	)
+
+	probeOutput, err := probeCmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrProbeError, err)
+	}
+
+	var parsed ffprobeOutput
+
+	err = json.Unmarshal(probeOutput, &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrProbeError, err)
+	}
+
+	if len(parsed.Streams) == 0 {
+		return nil, fmt.Errorf("%w: %w (%s)", ErrTranscoder, ErrProbeError, "no audio streams found")
+	}
+
+	stream := parsed.Streams[0]
+	info := &models.SourceInfo{
+		Channels:      stream.Channels,
+		ChannelLayout: stream.ChannelLayout,
+	}
+
+	if sr, err := strconv.Atoi(stream.SampleRate); err == nil && sr > 0 {
+		info.SampleRate = sr
+	}
+
+	// Prefer bits_per_raw_sample: 24-bit FLACs are decoded into s32, so the
+	// sample format alone is not enough to tell the real bit depth.
+	if bd, err := strconv.Atoi(stream.BitsPerRawSample); err == nil && bd > 0 {
+		info.BitDepth = bd
+	} else {
+		switch {
+		case strings.HasPrefix(stream.SampleFmt, "s16"):
+			info.BitDepth = 16
+		case strings.HasPrefix(stream.SampleFmt, "s32"), strings.HasPrefix(stream.SampleFmt, "flt"):
+			info.BitDepth = 32
+		case strings.HasPrefix(stream.SampleFmt, "s64"), strings.HasPrefix(stream.SampleFmt, "dbl"):
+			info.BitDepth = 64
+		}
+	}
+
+	if seconds, err := strconv.ParseFloat(stream.Duration, 64); err == nil {
+		info.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	return info, nil
+}
@@ -0,0 +1,189 @@
+package transcoder
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
+)
+
+// ProfileKey returns the fingerprint of the active profile settings, including
+// its filter chain. Files transcoded with different profile settings must
+// never share the cache.
+func (t *Transcoder) ProfileKey() string {
+	return t.profileKey
+}
+
+func (t *Transcoder) calculateProfileKey() (string, error) {
+	// JSON is used instead of Go formatting to get the values behind pointers.
+	rawProfile, err := json.Marshal(t.profile)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrInvalidProfile, err)
+	}
+
+	hash := md5.Sum(rawProfile)
+
+	return t.profileName + "-" + hex.EncodeToString(hash[:]), nil
+}
+
+// targetSampleRate picks the best output sample rate for the source sample rate.
+// Sources that fit the profile are never resampled. Otherwise, the highest
+// rate of the preferred family that fits the profile is used, so 88.2 and
+// 176.4 kHz sources are resampled with integer ratio into 44.1 kHz.
+func (t *Transcoder) targetSampleRate(sourceRate int) int {
+	maxRate := t.profile.MaxSampleRate
+	if sourceRate <= maxRate {
+		return sourceRate
+	}
+
+	var baseRate int
+
+	switch t.profile.DSP.RateFamily {
+	case configuration.RateFamily44100:
+		baseRate = 44100
+	case configuration.RateFamily48000:
+		baseRate = 48000
+	default:
+		baseRate = 48000
+		if sourceRate%11025 == 0 {
+			baseRate = 44100
+		}
+	}
+
+	for baseRate > maxRate {
+		baseRate /= 2
+	}
+
+	for baseRate*2 <= maxRate {
+		baseRate *= 2
+	}
+
+	return baseRate
+}
+
+// targetBitDepth returns the output bit depth for the source bit depth.
+// Lossy codecs don't care about the bit depth, so it's always kept as is.
+func (t *Transcoder) targetBitDepth(sourceBitDepth int) int {
+	if t.profile.Codec != configuration.CodecALAC || sourceBitDepth <= t.profile.MaxBitDepth {
+		return sourceBitDepth
+	}
+
+	return t.profile.MaxBitDepth
+}
+
+// resampleFilter returns the aresample filter which converts audio into the
+// target sample rate and bit depth with the profile's resampler and dither.
+func (t *Transcoder) resampleFilter(targetRate, targetBitDepth int, resample, requantize bool) string {
+	options := make([]string, 0)
+
+	if resample {
+		options = append(options, "osr="+strconv.Itoa(targetRate))
+	}
+
+	if requantize {
+		sampleFmt := "s16p"
+		if targetBitDepth > 16 {
+			sampleFmt = "s32p"
+		}
+
+		options = append(options, "osf="+sampleFmt)
+	}
+
+	options = append(options, "resampler="+t.profile.DSP.Resampler)
+
+	if t.profile.DSP.Resampler == configuration.ResamplerSoXR {
+		options = append(options, "precision="+strconv.Itoa(t.profile.DSP.Precision))
+	}
+
+	if requantize {
+		// Noise shaping methods are dither methods in terms of swresample.
+		ditherMethod := t.profile.DSP.Dither
+		if t.profile.DSP.NoiseShaping != configuration.DitherNone {
+			ditherMethod = t.profile.DSP.NoiseShaping
+		}
+
+		if ditherMethod != configuration.DitherNone {
+			options = append(options, "dither_method="+ditherMethod)
+		}
+	}
+
+	return "aresample=" + strings.Join(options, ":")
+}
+
+// filterChain returns the ffmpeg audio filter chain for the transcode. The
+// channel conversion goes first, so crossfeed always gets stereo, then the
+// user filters work on the source signal, and the resampler goes last, so
+// the dither is applied to the final signal.
+func (t *Transcoder) filterChain(
+	channelFilter string, targetRate, targetBitDepth int, resample, requantize bool,
+) string {
+	filters := make([]string, 0, len(t.profile.Filters)+2)
+
+	if channelFilter != "" {
+		filters = append(filters, channelFilter)
+	}
+
+	filters = append(filters, t.profile.Filters...)
+
+	if resample || requantize {
+		filters = append(filters, t.resampleFilter(targetRate, targetBitDepth, resample, requantize))
+	}
+
+	return strings.Join(filters, ",")
+}
+
+// validateFilters makes sure ffmpeg accepts the filter chains of all profiles
+// by running them on a short chunk of generated silence.
+func (t *Transcoder) validateFilters() error {
+	for name, profile := range t.app.Config().Transcoding.Profiles {
+		if len(profile.Filters) == 0 {
+			continue
+		}
+
+		validateCmd := exec.Command(
+			"ffmpeg",
+			"-v", "error",
+			"-f", "lavfi",
+			"-i", "anullsrc=r=48000:cl=stereo",
+			"-t", "0.1",
+			"-af", strings.Join(profile.Filters, ","),
+			"-f", "null",
+			"-",
+		)
+
+		var stderr bytes.Buffer
+
+		validateCmd.Stderr = &stderr
+
+		err := validateCmd.Run()
+		if err != nil {
+			return fmt.Errorf(
+				"%w: %w (%s)", ErrTranscoder, ErrInvalidFilterChain,
+				fmt.Sprintf("profile %q: %s: %s", name, err, strings.TrimSpace(stderr.String())),
+			)
+		}
+
+		t.app.Logger().WithFields(logrus.Fields{
+			"profile": name,
+			"filters": profile.Filters,
+		}).Debug("Validated profile filter chain")
+	}
+
+	return nil
+}
+
+// codecArgs returns ffmpeg audio encoder arguments for the profile.
+func (t *Transcoder) codecArgs() []string {
+	if t.profile.Codec == configuration.CodecAAC {
+		return []string{"-c:a", "aac", "-b:a", t.profile.Bitrate}
+	}
+
+	return []string{"-c:a", "alac"}
+}
@@ -2,6 +2,7 @@ package transcoder
 
 import (
 	"source.hodakov.me/hdkv/faketunes/internal/application"
+	"source.hodakov.me/hdkv/faketunes/internal/configuration"
 	"source.hodakov.me/hdkv/faketunes/internal/domains"
 )
 
@@ -13,13 +14,28 @@ var (
 type Transcoder struct {
 	app            *application.App
 	transcodeQueue chan struct{}
+
+	profileName   string
+	profile       configuration.Profile
+	profileKey    string
+	profileKeyErr error
 }
 
 func New(app *application.App) *Transcoder {
-	return &Transcoder{
+	profileName, profile := app.Config().Transcoding.ActiveProfile()
+
+	t := &Transcoder{
 		app:            app,
 		transcodeQueue: make(chan struct{}, app.Config().Transcoding.Parallel),
+		profileName:    profileName,
+		profile:        profile,
 	}
+
+	// The key is ready before any domain starts, the cache keys depend on
+	// it. The error is reported by Start.
+	t.profileKey, t.profileKeyErr = t.calculateProfileKey()
+
+	return t
 }
 
 func (t *Transcoder) ConnectDependencies() error {
@@ -27,5 +43,16 @@ func (t *Transcoder) ConnectDependencies() error {
 }
 
 func (t *Transcoder) Start() error {
+	if t.profileKeyErr != nil {
+		return t.profileKeyErr
+	}
+
+	err := t.validateFilters()
+	if err != nil {
+		return err
+	}
+
+	t.app.Logger().WithField("profile", t.profileName).Info("Using transcoding profile")
+
 	return nil
 }
@@ -0,0 +1,103 @@
+package transcoder
+
+import (
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"source.hodakov.me/hdkv/faketunes/internal/flac"
+)
+
+// durationTolerance is the maximum allowed difference between the source and
+// the transcoded file durations. Resamplers may add or drop a few samples.
+const durationTolerance = 100 * time.Millisecond
+
+// verify checks the transcoded file against its source. Lossless transcodes
+// (neither resampled nor bit-reduced) must decode to the same PCM as the
+// source FLAC, all other transcodes must keep the source duration.
+func (t *Transcoder) verify(sourcePath, destinationPath string, lossless bool) error {
+	streamInfo, err := flac.ReadStreamInfo(sourcePath)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrVerificationFailed, err)
+	}
+
+	if lossless {
+		return t.verifyPCM(sourcePath, destinationPath, streamInfo)
+	}
+
+	return t.verifyDuration(sourcePath, destinationPath, streamInfo)
+}
+
+func (t *Transcoder) verifyPCM(sourcePath, destinationPath string, streamInfo *flac.StreamInfo) error {
+	var expectedMD5 string
+
+	// FLAC STREAMINFO MD5 is calculated over byte-aligned samples, so it can
+	// be compared directly only for 8, 16, 24 and 32 bit sources. For other
+	// bit depths, or if the encoder didn't store the MD5, decode the source.
+	if streamInfo.HasMD5() && streamInfo.BitsPerSample%8 == 0 {
+		expectedMD5 = hex.EncodeToString(streamInfo.MD5[:])
+	} else {
+		sourceDigest, err := t.decodePCM(sourcePath, streamInfo.BitsPerSample, false)
+		if err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrVerificationFailed, err)
+		}
+
+		expectedMD5 = sourceDigest.MD5
+	}
+
+	destinationDigest, err := t.decodePCM(destinationPath, streamInfo.BitsPerSample, false)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrVerificationFailed, err)
+	}
+
+	actualMD5 := destinationDigest.MD5
+
+	t.app.Logger().WithFields(logrus.Fields{
+		"source file":  sourcePath,
+		"expected md5": expectedMD5,
+		"actual md5":   actualMD5,
+	}).Debug("Verified transcoded file PCM checksum")
+
+	if expectedMD5 != actualMD5 {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrTranscoder, ErrVerificationFailed,
+			fmt.Sprintf("PCM MD5 mismatch: expected %s, got %s", expectedMD5, actualMD5),
+		)
+	}
+
+	return nil
+}
+
+func (t *Transcoder) verifyDuration(sourcePath, destinationPath string, streamInfo *flac.StreamInfo) error {
+	expectedDuration := streamInfo.Duration()
+	if expectedDuration == 0 {
+		// Total samples count is optional in STREAMINFO, ask ffprobe instead.
+		sourceInfo, err := t.probe(sourcePath)
+		if err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrVerificationFailed, err)
+		}
+
+		expectedDuration = sourceInfo.Duration
+	}
+
+	destinationInfo, err := t.probe(destinationPath)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrTranscoder, ErrVerificationFailed, err)
+	}
+
+	t.app.Logger().WithFields(logrus.Fields{
+		"source file":       sourcePath,
+		"expected duration": expectedDuration,
+		"actual duration":   destinationInfo.Duration,
+	}).Debug("Verified transcoded file duration")
+
+	if (expectedDuration - destinationInfo.Duration).Abs() > durationTolerance {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrTranscoder, ErrVerificationFailed,
+			fmt.Sprintf("duration mismatch: expected %s, got %s", expectedDuration, destinationInfo.Duration),
+		)
+	}
+
+	return nil
+}
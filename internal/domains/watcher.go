@@ -0,0 +1,5 @@
+package domains
+
+const WatcherName = "watcher"
+
+type Watcher any
@@ -0,0 +1,49 @@
+package watcher
+
+import "time"
+
+func (w *Watcher) queueChange(path string) {
+	w.pendingMutex.Lock()
+	w.pending[path] = struct{}{}
+	w.pendingMutex.Unlock()
+}
+
+// processChanges applies the queued changes once every debounce interval, so
+// a file being written produces a single invalidation.
+func (w *Watcher) processChanges() {
+	ticker := time.NewTicker(w.debounce)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.app.Context().Done():
+			w.app.Logger().Debug("Application context cancelled, stopping source library watcher...")
+
+			err := w.inotifyFile.Close()
+			if err != nil {
+				w.app.Logger().WithError(err).Error("Failed to close inotify")
+			}
+
+			return
+		case <-ticker.C:
+			w.flushChanges()
+		}
+	}
+}
+
+func (w *Watcher) flushChanges() {
+	w.pendingMutex.Lock()
+	pending := w.pending
+	w.pending = make(map[string]struct{}, 0)
+	w.pendingMutex.Unlock()
+
+	for path := range pending {
+		w.cacher.Invalidate(path)
+		w.library.Invalidate(path)
+		w.filesystem.InvalidateSource(path)
+	}
+
+	if len(pending) > 0 {
+		w.app.Logger().WithField("paths", len(pending)).Debug("Applied source library changes")
+	}
+}
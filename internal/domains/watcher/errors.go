@@ -0,0 +1,11 @@
+package watcher
+
+import "errors"
+
+var (
+	ErrWatcher              = errors.New("watcher")
+	ErrConnectDependencies  = errors.New("failed to connect dependencies")
+	ErrFailedToGetWaitGroup = errors.New("failed to get global waitgroup")
+	ErrFailedToInitInotify  = errors.New("failed to initialize inotify")
+	ErrFailedToAddWatch     = errors.New("failed to add inotify watch")
+)
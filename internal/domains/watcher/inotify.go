@@ -0,0 +1,173 @@
+package watcher
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	watchMask = unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO |
+		unix.IN_CLOSE_WRITE | unix.IN_ATTRIB | unix.IN_ONLYDIR
+	eventsBufferSize = 64 * 1024
+)
+
+func (w *Watcher) initInotify() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrWatcher, ErrFailedToInitInotify, err)
+	}
+
+	// Non-blocking descriptor is handled by the runtime poller, so closing
+	// the file interrupts the pending read on shutdown.
+	// Fd() must not be called on it, as it switches the descriptor back to
+	// blocking mode.
+	w.inotifyFD = fd
+	w.inotifyFile = os.NewFile(uintptr(fd), "inotify")
+
+	return nil
+}
+
+// watchTree adds watches for the directory and all its subdirectories.
+// When queue is set, every found path is queued as changed: the tree could be
+// populated before the watches were added.
+func (w *Watcher) watchTree(root string, queue bool) error {
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// The tree could be changed while walking, the events about it
+			// will come later.
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+
+			return err
+		}
+
+		if queue {
+			w.queueChange(path)
+		}
+
+		if !entry.IsDir() {
+			return nil
+		}
+
+		return w.addWatch(path)
+	})
+}
+
+func (w *Watcher) addWatch(path string) error {
+	wd, err := unix.InotifyAddWatch(w.inotifyFD, path, watchMask)
+	if err != nil {
+		if errors.Is(err, unix.ENOSPC) {
+			return fmt.Errorf(
+				"%w: %w (%w, consider raising fs.inotify.max_user_watches)",
+				ErrWatcher, ErrFailedToAddWatch, err,
+			)
+		}
+
+		return fmt.Errorf("%w: %w (%w)", ErrWatcher, ErrFailedToAddWatch, err)
+	}
+
+	w.watchesMutex.Lock()
+	w.watches[wd] = path
+	w.watchesMutex.Unlock()
+
+	return nil
+}
+
+// readEvents reads inotify events until the inotify file is closed.
+func (w *Watcher) readEvents() {
+	buffer := make([]byte, eventsBufferSize)
+
+	for {
+		n, err := w.inotifyFile.Read(buffer)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.app.Logger().WithError(err).Error("Failed to read inotify events, stopping watcher")
+			}
+
+			return
+		}
+
+		offset := 0
+		for offset+unix.SizeofInotifyEvent <= n {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buffer[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+
+			name := string(bytes.TrimRight(buffer[nameStart:nameEnd], "\x00"))
+			w.handleEvent(int(event.Wd), event.Mask, event.Cookie, name)
+
+			offset = nameEnd
+		}
+	}
+}
+
+func (w *Watcher) handleEvent(wd int, mask, cookie uint32, name string) {
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		w.app.Logger().Warn("Inotify event queue overflowed, rescanning source library")
+
+		err := w.watchTree(w.sourceDir, true)
+		if err != nil {
+			w.app.Logger().WithError(err).Error("Failed to rescan source library")
+		}
+
+		return
+	}
+
+	w.watchesMutex.Lock()
+	dir, ok := w.watches[wd]
+
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.watches, wd)
+	}
+
+	w.watchesMutex.Unlock()
+
+	if !ok || name == "" {
+		return
+	}
+
+	path := filepath.Join(dir, name)
+
+	w.app.Logger().WithFields(logrus.Fields{
+		"path": path,
+		"mask": fmt.Sprintf("%#x", mask),
+	}).Debug("Got source library change")
+
+	w.trackMove(mask, cookie, path)
+
+	w.queueChange(path)
+	w.queueChange(dir)
+
+	if mask&unix.IN_ISDIR != 0 && mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+		err := w.watchTree(path, true)
+		if err != nil {
+			w.app.Logger().WithError(err).WithField("path", path).
+				Error("Failed to watch new source directory")
+		}
+	}
+}
+
+// trackMove pairs the halves of the rename within the source library, so the
+// filesystem carries the client data of the renamed object over. The kernel
+// queues both halves one after another.
+func (w *Watcher) trackMove(mask, cookie uint32, path string) {
+	switch {
+	case mask&unix.IN_MOVED_FROM != 0:
+		w.movedFrom, w.movedCookie = path, cookie
+	case mask&unix.IN_MOVED_TO != 0 && w.movedFrom != "" && cookie == w.movedCookie:
+		w.filesystem.MoveSource(w.movedFrom, path)
+
+		w.movedFrom = ""
+	default:
+		w.movedFrom = ""
+	}
+}
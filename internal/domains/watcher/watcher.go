@@ -0,0 +1,130 @@
+package watcher
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"source.hodakov.me/hdkv/faketunes/internal/application"
+	"source.hodakov.me/hdkv/faketunes/internal/domains"
+)
+
+const defaultDebounce = 2 * time.Second
+
+var (
+	_ domains.Watcher = new(Watcher)
+	_ domains.Domain  = new(Watcher)
+)
+
+// Watcher tracks changes in the source library with inotify and makes the
+// cacher, the library index and the kernel forget about the changed files.
+type Watcher struct {
+	app *application.App
+
+	cacher     domains.Cacher
+	filesystem domains.Filesystem
+	library    domains.Library
+
+	sourceDir string
+	debounce  time.Duration
+
+	inotifyFD    int
+	inotifyFile  *os.File
+	watches      map[int]string
+	watchesMutex sync.Mutex
+
+	// movedFrom is the source path of the rename waiting for its second
+	// half. It's used by the events reader only.
+	movedFrom   string
+	movedCookie uint32
+
+	pending      map[string]struct{}
+	pendingMutex sync.Mutex
+}
+
+func New(app *application.App) *Watcher {
+	debounce := app.Config().Watcher.Debounce
+	if debounce <= 0 {
+		debounce = defaultDebounce
+	}
+
+	return &Watcher{
+		app:       app,
+		sourceDir: app.Config().Paths.Source,
+		debounce:  debounce,
+		watches:   make(map[int]string, 0),
+		pending:   make(map[string]struct{}, 0),
+	}
+}
+
+func (w *Watcher) ConnectDependencies() error {
+	cacher, ok := w.app.RetrieveDomain(domains.CacherName).(domains.Cacher)
+	if !ok {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrWatcher, ErrConnectDependencies,
+			"cacher domain interface conversion failed",
+		)
+	}
+
+	w.cacher = cacher
+
+	filesystem, ok := w.app.RetrieveDomain(domains.FilesystemName).(domains.Filesystem)
+	if !ok {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrWatcher, ErrConnectDependencies,
+			"filesystem domain interface conversion failed",
+		)
+	}
+
+	w.filesystem = filesystem
+
+	library, ok := w.app.RetrieveDomain(domains.LibraryName).(domains.Library)
+	if !ok {
+		return fmt.Errorf(
+			"%w: %w (%s)", ErrWatcher, ErrConnectDependencies,
+			"library domain interface conversion failed",
+		)
+	}
+
+	w.library = library
+
+	return nil
+}
+
+func (w *Watcher) Start() error {
+	if !w.app.Config().Watcher.Enabled {
+		return nil
+	}
+
+	err := w.initInotify()
+	if err != nil {
+		return err
+	}
+
+	err = w.watchTree(w.sourceDir, false)
+	if err != nil {
+		w.inotifyFile.Close()
+
+		return err
+	}
+
+	wg := w.app.GetGlobalWaitGroup()
+	if wg == nil {
+		w.inotifyFile.Close()
+
+		return fmt.Errorf("%w: %w (%s)", ErrWatcher, ErrFailedToGetWaitGroup, "got nil waitgroup")
+	}
+
+	w.app.Logger().WithField("watches", len(w.watches)).Info("Watching source library for changes")
+
+	wg.Go(func() {
+		w.readEvents()
+	})
+
+	wg.Go(func() {
+		w.processChanges()
+	})
+
+	return nil
+}
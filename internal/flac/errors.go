@@ -0,0 +1,12 @@
+package flac
+
+import "errors"
+
+var (
+	ErrFLAC                   = errors.New("flac")
+	ErrCantReadFile           = errors.New("can't read file")
+	ErrNotAFLACFile           = errors.New("not a FLAC file")
+	ErrNoStreamInfo           = errors.New("STREAMINFO block not found")
+	ErrMalformedHeader        = errors.New("malformed metadata block header")
+	ErrMalformedVorbisComment = errors.New("malformed VORBIS_COMMENT block")
+)
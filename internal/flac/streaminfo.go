@@ -0,0 +1,146 @@
+package flac
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	streamInfoBlockType   = 0
+	streamInfoBlockLength = 34
+	id3v2HeaderLength     = 10
+)
+
+var flacMarker = []byte("fLaC")
+
+// StreamInfo represents the STREAMINFO metadata block of a FLAC file.
+type StreamInfo struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	TotalSamples  uint64
+	MD5           [16]byte
+}
+
+// Duration returns the stream duration calculated from the total samples count.
+// It returns zero if the encoder didn't store the total samples count.
+func (s *StreamInfo) Duration() time.Duration {
+	if s.SampleRate == 0 {
+		return 0
+	}
+
+	// Whole seconds first: the samples count in nanoseconds overflows for
+	// long high-resolution streams.
+	rate := uint64(s.SampleRate)
+	seconds := time.Duration(s.TotalSamples/rate) * time.Second
+
+	return seconds + time.Duration(s.TotalSamples%rate)*time.Second/time.Duration(rate)
+}
+
+// HasMD5 reports whether the encoder stored the unencoded audio MD5 signature.
+// Some encoders leave it zeroed.
+func (s *StreamInfo) HasMD5() bool {
+	return s.MD5 != [16]byte{}
+}
+
+// ReadStreamInfo reads the STREAMINFO block of the FLAC file at path.
+func ReadStreamInfo(path string) (*StreamInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrCantReadFile, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	err = skipFLACMarker(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	blockType, blockLength, _, err := readBlockHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	// STREAMINFO is mandatory and must be the first metadata block.
+	if blockType != streamInfoBlockType || blockLength != streamInfoBlockLength {
+		return nil, fmt.Errorf("%w: %w (%s)", ErrFLAC, ErrNoStreamInfo, path)
+	}
+
+	block := make([]byte, streamInfoBlockLength)
+
+	_, err = io.ReadFull(reader, block)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrCantReadFile, err)
+	}
+
+	return parseStreamInfo(block), nil
+}
+
+// skipFLACMarker positions the reader right after the "fLaC" stream marker.
+// Some taggers prepend an ID3v2 tag to FLAC files, so it is skipped if present.
+func skipFLACMarker(reader *bufio.Reader) error {
+	header, err := reader.Peek(id3v2HeaderLength)
+	if err != nil {
+		return fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrNotAFLACFile, err)
+	}
+
+	if bytes.HasPrefix(header, []byte("ID3")) {
+		// ID3v2 tag size is a 28-bit syncsafe integer excluding the header.
+		tagSize := int(header[6])<<21 | int(header[7])<<14 | int(header[8])<<7 | int(header[9])
+
+		_, err = reader.Discard(id3v2HeaderLength + tagSize)
+		if err != nil {
+			return fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrNotAFLACFile, err)
+		}
+	}
+
+	marker := make([]byte, len(flacMarker))
+
+	_, err = io.ReadFull(reader, marker)
+	if err != nil || !bytes.Equal(marker, flacMarker) {
+		return fmt.Errorf("%w: %w (%s)", ErrFLAC, ErrNotAFLACFile, "no fLaC stream marker")
+	}
+
+	return nil
+}
+
+// readBlockHeader reads a metadata block header and returns the block type,
+// block length and whether this block is the last metadata block.
+func readBlockHeader(reader io.Reader) (byte, int, bool, error) {
+	header := make([]byte, 4)
+
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrMalformedHeader, err)
+	}
+
+	isLast := header[0]&0x80 != 0
+	blockType := header[0] & 0x7f
+	blockLength := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+
+	return blockType, blockLength, isLast, nil
+}
+
+func parseStreamInfo(block []byte) *StreamInfo {
+	// Bytes 10-17 hold sample rate (20 bits), channels - 1 (3 bits),
+	// bits per sample - 1 (5 bits) and total samples (36 bits).
+	packed := binary.BigEndian.Uint64(block[10:18])
+
+	info := &StreamInfo{
+		SampleRate:    int(packed >> 44),
+		Channels:      int((packed>>41)&0x07) + 1,
+		BitsPerSample: int((packed>>36)&0x1f) + 1,
+		TotalSamples:  packed & 0xfffffffff,
+	}
+
+	copy(info.MD5[:], block[18:34])
+
+	return info
+}
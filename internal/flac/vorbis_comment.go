@@ -0,0 +1,125 @@
+package flac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const vorbisCommentBlockType = 4
+
+// Tags are the Vorbis comments of a FLAC file. Field names are case
+// insensitive, so they are stored uppercased. A field may have several
+// values, like multiple artists or genres.
+type Tags map[string][]string
+
+// Get returns the first value of the field, or an empty string.
+func (t Tags) Get(field string) string {
+	values := t[strings.ToUpper(field)]
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
+
+// Values returns all the values of the field.
+func (t Tags) Values(field string) []string {
+	return t[strings.ToUpper(field)]
+}
+
+// ReadTags reads the VORBIS_COMMENT block of the FLAC file at path. Files
+// without the block have no tags, that's not an error.
+func ReadTags(path string) (Tags, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrCantReadFile, err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	err = skipFLACMarker(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		blockType, blockLength, isLast, err := readBlockHeader(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		if blockType == vorbisCommentBlockType {
+			block := make([]byte, blockLength)
+
+			_, err = io.ReadFull(reader, block)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrCantReadFile, err)
+			}
+
+			return parseVorbisComment(block)
+		}
+
+		if isLast {
+			return Tags{}, nil
+		}
+
+		_, err = reader.Discard(blockLength)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w (%w)", ErrFLAC, ErrMalformedHeader, err)
+		}
+	}
+}
+
+// parseVorbisComment parses the block: the vendor string and the list of
+// "FIELD=value" comments, all lengths are 32-bit little-endian.
+func parseVorbisComment(block []byte) (Tags, error) {
+	readString := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+
+		length := binary.LittleEndian.Uint32(block)
+		block = block[4:]
+
+		if uint64(length) > uint64(len(block)) {
+			return "", false
+		}
+
+		value := string(block[:length])
+		block = block[length:]
+
+		return value, true
+	}
+
+	// Vendor string.
+	if _, ok := readString(); !ok || len(block) < 4 {
+		return nil, fmt.Errorf("%w: %w (%s)", ErrFLAC, ErrMalformedVorbisComment, "truncated vendor string")
+	}
+
+	count := binary.LittleEndian.Uint32(block)
+	block = block[4:]
+
+	tags := make(Tags, 0)
+
+	for range count {
+		comment, ok := readString()
+		if !ok {
+			return nil, fmt.Errorf("%w: %w (%s)", ErrFLAC, ErrMalformedVorbisComment, "truncated comment")
+		}
+
+		field, value, ok := strings.Cut(comment, "=")
+		if !ok || field == "" {
+			continue
+		}
+
+		field = strings.ToUpper(field)
+		tags[field] = append(tags[field], value)
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,10 @@
+package pathtemplate
+
+import "errors"
+
+var (
+	ErrPathTemplate    = errors.New("path template")
+	ErrSyntax          = errors.New("syntax error")
+	ErrUnknownFunction = errors.New("unknown function")
+	ErrWrongArguments  = errors.New("wrong number of function arguments")
+)
@@ -0,0 +1,98 @@
+package pathtemplate
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type function struct {
+	minArgs int
+	maxArgs int
+	call    func(ctx Context, args [][]node) string
+}
+
+var functions = map[string]*function{
+	"lower": {1, 1, func(ctx Context, args [][]node) string {
+		return strings.ToLower(executeNodes(ctx, args[0]))
+	}},
+	"upper": {1, 1, func(ctx Context, args [][]node) string {
+		return strings.ToUpper(executeNodes(ctx, args[0]))
+	}},
+	"title": {1, 1, func(ctx Context, args [][]node) string {
+		return titleCase(executeNodes(ctx, args[0]))
+	}},
+	"left": {2, 2, func(ctx Context, args [][]node) string {
+		text := []rune(executeNodes(ctx, args[0]))
+
+		return string(text[:min(intArgument(ctx, args[1]), len(text))])
+	}},
+	"right": {2, 2, func(ctx Context, args [][]node) string {
+		text := []rune(executeNodes(ctx, args[0]))
+
+		return string(text[len(text)-min(intArgument(ctx, args[1]), len(text)):])
+	}},
+	"if": {2, 3, func(ctx Context, args [][]node) string {
+		if truthy(executeNodes(ctx, args[0])) {
+			return executeNodes(ctx, args[1])
+		}
+
+		if len(args) > 2 {
+			return executeNodes(ctx, args[2])
+		}
+
+		return ""
+	}},
+	"ifdef": {2, 3, func(ctx Context, args [][]node) string {
+		field := strings.ToLower(strings.TrimSpace(executeNodes(ctx, args[0])))
+		if ctx.Field(field) != "" {
+			return executeNodes(ctx, args[1])
+		}
+
+		if len(args) > 2 {
+			return executeNodes(ctx, args[2])
+		}
+
+		return ""
+	}},
+	"aunique": {0, 0, func(ctx Context, _ [][]node) string {
+		return ctx.AlbumUnique()
+	}},
+}
+
+func intArgument(ctx Context, arg []node) int {
+	value, err := strconv.Atoi(strings.TrimSpace(executeNodes(ctx, arg)))
+	if err != nil || value < 0 {
+		return 0
+	}
+
+	return value
+}
+
+func truthy(value string) bool {
+	value = strings.TrimSpace(value)
+
+	return value != "" && value != "0" && !strings.EqualFold(value, "false")
+}
+
+func titleCase(text string) string {
+	var builder strings.Builder
+
+	wordStart := true
+
+	for len(text) > 0 {
+		char, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+
+		if wordStart {
+			builder.WriteRune(unicode.ToUpper(char))
+		} else {
+			builder.WriteRune(char)
+		}
+
+		wordStart = unicode.IsSpace(char) || char == '-' || char == '('
+	}
+
+	return builder.String()
+}
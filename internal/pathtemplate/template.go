@@ -0,0 +1,252 @@
+package pathtemplate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Context provides the values for the template: the track fields, and the
+// album disambiguation for %aunique{}.
+type Context interface {
+	Field(name string) string
+	AlbumUnique() string
+}
+
+// Template is the parsed beets-like path template, like
+// "$albumartist/$album%aunique{}/$disc$track $title". Fields are written as
+// $name or ${name}, functions as %name{argument,argument}, and "$$", "$%",
+// "$," and "$}" are the escapes for the special characters.
+type Template struct {
+	source string
+	nodes  []node
+}
+
+type node interface {
+	execute(ctx Context) string
+}
+
+type literalNode string
+
+func (n literalNode) execute(Context) string {
+	return string(n)
+}
+
+type fieldNode string
+
+func (n fieldNode) execute(ctx Context) string {
+	return ctx.Field(string(n))
+}
+
+type callNode struct {
+	function *function
+	args     [][]node
+}
+
+func (n *callNode) execute(ctx Context) string {
+	return n.function.call(ctx, n.args)
+}
+
+// Parse parses the template.
+func Parse(source string) (*Template, error) {
+	p := &parser{source: source}
+
+	nodes, err := p.parseNodes(false)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.source) {
+		return nil, p.errorf("unexpected %q", p.source[p.pos])
+	}
+
+	return &Template{source: source, nodes: nodes}, nil
+}
+
+// Execute renders the template.
+func (t *Template) Execute(ctx Context) string {
+	return executeNodes(ctx, t.nodes)
+}
+
+func (t *Template) String() string {
+	return t.source
+}
+
+func executeNodes(ctx Context, nodes []node) string {
+	var builder strings.Builder
+
+	for _, n := range nodes {
+		builder.WriteString(n.execute(ctx))
+	}
+
+	return builder.String()
+}
+
+type parser struct {
+	source string
+	pos    int
+}
+
+// parseNodes parses the text until the end, or until the argument separator
+// or the closing brace when parsing the function arguments.
+func (p *parser) parseNodes(inArgument bool) ([]node, error) {
+	var (
+		nodes   []node
+		literal strings.Builder
+	)
+
+	flushLiteral := func() {
+		if literal.Len() > 0 {
+			nodes = append(nodes, literalNode(literal.String()))
+			literal.Reset()
+		}
+	}
+
+	for p.pos < len(p.source) {
+		char := p.source[p.pos]
+
+		switch {
+		case inArgument && (char == ',' || char == '}'):
+			flushLiteral()
+
+			return nodes, nil
+		case char == '$':
+			p.pos++
+
+			if p.pos < len(p.source) && strings.IndexByte("$%,}", p.source[p.pos]) >= 0 {
+				literal.WriteByte(p.source[p.pos])
+				p.pos++
+
+				continue
+			}
+
+			name, err := p.parseFieldName()
+			if err != nil {
+				return nil, err
+			}
+
+			flushLiteral()
+			nodes = append(nodes, fieldNode(name))
+		case char == '%':
+			call, err := p.parseCall()
+			if err != nil {
+				return nil, err
+			}
+
+			flushLiteral()
+			nodes = append(nodes, call)
+		default:
+			literal.WriteByte(char)
+			p.pos++
+		}
+	}
+
+	flushLiteral()
+
+	return nodes, nil
+}
+
+func (p *parser) parseFieldName() (string, error) {
+	if p.pos < len(p.source) && p.source[p.pos] == '{' {
+		end := strings.IndexByte(p.source[p.pos:], '}')
+		if end < 0 {
+			return "", p.errorf("unterminated ${")
+		}
+
+		name := p.source[p.pos+1 : p.pos+end]
+		p.pos += end + 1
+
+		if name == "" || p.identifierLength(name) != len(name) {
+			return "", p.errorf("invalid field name %q", name)
+		}
+
+		return strings.ToLower(name), nil
+	}
+
+	length := p.identifierLength(p.source[p.pos:])
+	if length == 0 {
+		return "", p.errorf("field name expected after $")
+	}
+
+	name := p.source[p.pos : p.pos+length]
+	p.pos += length
+
+	return strings.ToLower(name), nil
+}
+
+func (p *parser) parseCall() (*callNode, error) {
+	// Skip the %.
+	p.pos++
+
+	length := p.identifierLength(p.source[p.pos:])
+	if length == 0 {
+		return nil, p.errorf("function name expected after %%")
+	}
+
+	name := strings.ToLower(p.source[p.pos : p.pos+length])
+	p.pos += length
+
+	function, ok := functions[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %w (%%%s in %q)", ErrPathTemplate, ErrUnknownFunction, name, p.source)
+	}
+
+	if p.pos >= len(p.source) || p.source[p.pos] != '{' {
+		return nil, p.errorf("{ expected after %%%s", name)
+	}
+
+	p.pos++
+
+	var args [][]node
+
+	for {
+		arg, err := p.parseNodes(true)
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, arg)
+
+		if p.pos >= len(p.source) {
+			return nil, p.errorf("unterminated %%%s{", name)
+		}
+
+		separator := p.source[p.pos]
+		p.pos++
+
+		if separator == '}' {
+			break
+		}
+	}
+
+	// "%aunique{}" has a single empty argument.
+	if len(args) == 1 && len(args[0]) == 0 {
+		args = nil
+	}
+
+	if len(args) < function.minArgs || len(args) > function.maxArgs {
+		return nil, fmt.Errorf(
+			"%w: %w (%%%s takes %d to %d arguments, got %d)",
+			ErrPathTemplate, ErrWrongArguments, name, function.minArgs, function.maxArgs, len(args),
+		)
+	}
+
+	return &callNode{function: function, args: args}, nil
+}
+
+func (p *parser) identifierLength(text string) int {
+	for i := range len(text) {
+		char := text[i]
+		if !(char == '_' || char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9') {
+			return i
+		}
+	}
+
+	return len(text)
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf(
+		"%w: %w (%s at position %d in %q)",
+		ErrPathTemplate, ErrSyntax, fmt.Sprintf(format, args...), p.pos, p.source,
+	)
+}
@@ -0,0 +1,9 @@
+package query
+
+import "errors"
+
+var (
+	ErrQuery      = errors.New("query")
+	ErrSyntax     = errors.New("syntax error")
+	ErrEmptyQuery = errors.New("empty query")
+)
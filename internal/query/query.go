@@ -0,0 +1,167 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Context provides the field values of the matched item. A field may have
+// several values, like multiple artists or genres.
+type Context interface {
+	Values(field string) []string
+}
+
+// Query is the parsed search query, like `artist:radiohead year:1997 karma`.
+// Terms are written as field:value or as bare words matching any of the text
+// fields, values with spaces are double-quoted. The item matches if every
+// term is found in its field values, ignoring case and Unicode normalization
+// form. The field:low..high terms match the values in the range instead.
+type Query struct {
+	source string
+	terms  []term
+}
+
+type term struct {
+	fields []string
+	value  string
+	rng    *valueRange
+}
+
+// Parse parses the query. Bare words are matched against the text fields.
+func Parse(source string, textFields []string) (*Query, error) {
+	words, err := splitWords(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(words) == 0 {
+		return nil, fmt.Errorf("%w: %w (%q)", ErrQuery, ErrEmptyQuery, source)
+	}
+
+	query := &Query{source: source, terms: make([]term, 0, len(words))}
+
+	for _, word := range words {
+		field, value, ok := splitField(word)
+		if !ok {
+			query.terms = append(query.terms, term{fields: textFields, value: fold(word)})
+
+			continue
+		}
+
+		if value == "" {
+			return nil, fmt.Errorf("%w: %w (no value for field %q in %q)", ErrQuery, ErrSyntax, field, source)
+		}
+
+		if !strings.Contains(value, "..") {
+			query.terms = append(query.terms, term{fields: []string{field}, value: fold(value)})
+
+			continue
+		}
+
+		rng, err := parseRange(value)
+		if err != nil {
+			return nil, err
+		}
+
+		query.terms = append(query.terms, term{fields: []string{field}, rng: rng})
+	}
+
+	return query, nil
+}
+
+// Match reports whether the item matches every term of the query.
+func (q *Query) Match(ctx Context) bool {
+	now := time.Now()
+
+	for _, term := range q.terms {
+		if !term.match(ctx, now) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String returns the query source.
+func (q *Query) String() string {
+	return q.source
+}
+
+func (t *term) match(ctx Context, now time.Time) bool {
+	for _, field := range t.fields {
+		for _, value := range ctx.Values(field) {
+			if t.rng != nil && t.rng.contains(value, now) {
+				return true
+			}
+
+			if t.rng == nil && strings.Contains(fold(value), t.value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// splitWords splits the query by the spaces outside of the double quotes.
+// The quotes are removed, and the empty words are skipped.
+func splitWords(source string) ([]string, error) {
+	words := make([]string, 0)
+
+	var (
+		word   strings.Builder
+		quoted bool
+	)
+
+	for _, char := range source {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case unicode.IsSpace(char) && !quoted:
+			if word.Len() > 0 {
+				words = append(words, word.String())
+			}
+
+			word.Reset()
+		default:
+			word.WriteRune(char)
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("%w: %w (unterminated quote in %q)", ErrQuery, ErrSyntax, source)
+	}
+
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+
+	return words, nil
+}
+
+// splitField splits the field:value term. Words with other characters before
+// the colon, like "Live: 1975", are not fields.
+func splitField(word string) (string, string, bool) {
+	field, value, ok := strings.Cut(word, ":")
+	if !ok || field == "" {
+		return "", "", false
+	}
+
+	for _, char := range field {
+		if !unicode.IsLetter(char) && !unicode.IsDigit(char) && char != '_' {
+			return "", "", false
+		}
+	}
+
+	return strings.ToLower(field), value, true
+}
+
+// fold returns the form the values are compared in.
+func fold(value string) string {
+	return cases.Fold().String(norm.NFC.String(value))
+}
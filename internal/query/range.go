@@ -0,0 +1,174 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var relativeDatePattern = regexp.MustCompile(`^-(\d+)([dwmy])$`)
+
+// dateLayouts are the date forms of the range bounds and the field values,
+// with the length of the period each of them covers.
+var dateLayouts = []struct {
+	layout              string
+	years, months, days int
+}{
+	{time.DateOnly, 0, 0, 1},
+	{"2006-01", 0, 1, 0},
+	{"2006", 1, 0, 0},
+}
+
+// valueRange is the range of the field:low..high term, either bound may be
+// omitted. The bounds are numbers, like "rating:4..", or dates, like
+// "year:1990..1999", "added:2024-03.." or the relative "added:-30d..".
+type valueRange struct {
+	dates     bool
+	low, high *bound
+}
+
+// bound is the inclusive range bound. Dates cover the whole period, so the
+// "..2024" range includes the whole year.
+type bound struct {
+	number float64
+
+	date                time.Time
+	years, months, days int
+	relative            bool
+}
+
+// parseRange parses the range value. The range is compared as dates if any
+// bound is a date.
+func parseRange(value string) (*valueRange, error) {
+	lowValue, highValue, _ := strings.Cut(value, "..")
+	if lowValue == "" && highValue == "" {
+		return nil, fmt.Errorf("%w: %w (empty range %q)", ErrQuery, ErrSyntax, value)
+	}
+
+	result := &valueRange{dates: isDateBound(lowValue) || isDateBound(highValue)}
+
+	var err error
+
+	if lowValue != "" {
+		result.low, err = parseBound(lowValue, result.dates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if highValue != "" {
+		result.high, err = parseBound(highValue, result.dates)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+func isDateBound(value string) bool {
+	return relativeDatePattern.MatchString(value) || strings.Contains(value, "-") && !strings.HasPrefix(value, "-")
+}
+
+func parseBound(value string, dates bool) (*bound, error) {
+	if !dates {
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w (%q isn't a number)", ErrQuery, ErrSyntax, value)
+		}
+
+		return &bound{number: number}, nil
+	}
+
+	if match := relativeDatePattern.FindStringSubmatch(value); match != nil {
+		amount, _ := strconv.Atoi(match[1])
+
+		switch match[2] {
+		case "d":
+			return &bound{days: amount, relative: true}, nil
+		case "w":
+			return &bound{days: 7 * amount, relative: true}, nil
+		case "m":
+			return &bound{months: amount, relative: true}, nil
+		default:
+			return &bound{years: amount, relative: true}, nil
+		}
+	}
+
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout.layout, value, time.Local)
+		if err == nil {
+			return &bound{date: date, years: layout.years, months: layout.months, days: layout.days}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %w (%q isn't a date)", ErrQuery, ErrSyntax, value)
+}
+
+// start returns the first moment of the bound period.
+func (b *bound) start(now time.Time) time.Time {
+	if b.relative {
+		return now.AddDate(-b.years, -b.months, -b.days)
+	}
+
+	return b.date
+}
+
+// end returns the moment right after the bound period.
+func (b *bound) end(now time.Time) time.Time {
+	if b.relative {
+		return b.start(now)
+	}
+
+	return b.date.AddDate(b.years, b.months, b.days)
+}
+
+func (r *valueRange) contains(value string, now time.Time) bool {
+	value = strings.TrimSpace(value)
+
+	if !r.dates {
+		number, ok := parseNumber(value)
+
+		return ok &&
+			(r.low == nil || number >= r.low.number) &&
+			(r.high == nil || number <= r.high.number)
+	}
+
+	date, ok := parseDate(value)
+
+	return ok &&
+		(r.low == nil || !date.Before(r.low.start(now))) &&
+		(r.high == nil || date.Before(r.high.end(now)))
+}
+
+// parseNumber parses the number field value. The dates are compared by the
+// year, so "added:2024.." works as well as "year:2024..".
+func parseNumber(value string) (float64, bool) {
+	number, err := strconv.ParseFloat(value, 64)
+	if err == nil {
+		return number, true
+	}
+
+	date, ok := parseDate(value)
+
+	return float64(date.Year()), ok
+}
+
+// parseDate parses the date field value. Full timestamps are cut to the
+// date.
+func parseDate(value string) (time.Time, bool) {
+	if len(value) > len(time.DateOnly) {
+		value = value[:len(time.DateOnly)]
+	}
+
+	for _, layout := range dateLayouts {
+		date, err := time.ParseInLocation(layout.layout, value, time.Local)
+		if err == nil {
+			return date, true
+		}
+	}
+
+	return time.Time{}, false
+}